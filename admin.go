@@ -0,0 +1,137 @@
+package local_dns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(adminAPI{})
+}
+
+// adminAPI is a module that serves endpoints to inspect the
+// records managed by the local_dns app.
+type adminAPI struct {
+	app *App
+}
+
+// CaddyModule returns the Caddy module information.
+func (adminAPI) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.local_dns",
+		New: func() caddy.Module { return new(adminAPI) },
+	}
+}
+
+// Provision looks up the local_dns app, the endpoints report an
+// error if it isn't configured.
+func (a *adminAPI) Provision(ctx caddy.Context) error {
+	appIface, err := ctx.AppIfConfigured("local_dns")
+	if err == nil {
+		a.app = appIface.(*App)
+	}
+	return nil
+}
+
+// Routes returns the admin routes for the local_dns app.
+func (a *adminAPI) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/local_dns/records",
+			Handler: caddy.AdminHandlerFunc(a.handleRecords),
+		},
+		{
+			Pattern: "/local_dns/health",
+			Handler: caddy.AdminHandlerFunc(a.handleHealth),
+		},
+		{
+			Pattern: "/local_dns/diff",
+			Handler: caddy.AdminHandlerFunc(a.handleDiff),
+		},
+	}
+}
+
+// handleRecords returns the managed records as JSON.
+func (a *adminAPI) handleRecords(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed: %v", r.Method),
+		}
+	}
+	if a.app == nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        errors.New("local_dns app not configured"),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(a.app.ManagedRecords())
+}
+
+// handleHealth validates all providers and reports their status as JSON.
+// It answers 503 Service Unavailable if any provider is unhealthy.
+func (a *adminAPI) handleHealth(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed: %v", r.Method),
+		}
+	}
+	if a.app == nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        errors.New("local_dns app not configured"),
+		}
+	}
+
+	providers := a.app.CheckProviders(r.Context())
+	healthy := true
+	for _, p := range providers {
+		healthy = healthy && p.Healthy
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return json.NewEncoder(w).Encode(struct {
+		Healthy   bool             `json:"healthy"`
+		Providers []ProviderHealth `json:"providers"`
+	}{healthy, providers})
+}
+
+// handleDiff compares the desired records of all known domains with the
+// providers and returns the differences as JSON. Nothing is changed.
+func (a *adminAPI) handleDiff(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed: %v", r.Method),
+		}
+	}
+	if a.app == nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        errors.New("local_dns app not configured"),
+		}
+	}
+
+	diffs := a.app.Diff(r.Context())
+	if diffs == nil {
+		diffs = []RecordDiff{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(diffs)
+}
+
+// Interface compliance
+var (
+	_ caddy.Provisioner = (*adminAPI)(nil)
+	_ caddy.AdminRouter = (*adminAPI)(nil)
+)
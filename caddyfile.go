@@ -10,9 +10,12 @@ import (
 func init() {
 	// Register global app
 	httpcaddyfile.RegisterGlobalOption("local_dns", parseApp)
-	// Register site directive - specify order
+	// Register site directive. It runs after the request is rewritten
+	// (rewrite, uri, try_files), so matchers and only_on see the final
+	// path, but ahead of the handlers that may respond (handle, respond,
+	// error, reverse_proxy, ...). The order global option can still move it.
 	httpcaddyfile.RegisterHandlerDirective("local_dns", parseHandler)
-	httpcaddyfile.RegisterDirectiveOrder("local_dns", httpcaddyfile.Before, "reverse_proxy")
+	httpcaddyfile.RegisterDirectiveOrder("local_dns", httpcaddyfile.After, "try_files")
 }
 
 // parseApp configures the "local_dns" global option from Caddyfile.
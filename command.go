@@ -0,0 +1,134 @@
+package local_dns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/spf13/cobra"
+)
+
+// testTimeout bounds the checks of the test command
+const testTimeout = 30 * time.Second
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "local-dns",
+		Usage: "test [--config <path>] [--adapter <name>] [--domain <name>] <provider>",
+		Short: "Tests the DNS providers of the local_dns app",
+		Long: `
+Tests a provider of the local_dns app without starting the server.
+
+The test subcommand loads the config like caddy run, creates the named
+provider and checks its connection and credentials. It then looks up the
+records of a test domain, by default local-dns-test below the provider's
+zone. Nothing is changed on the DNS server.`,
+		CobraFunc: func(cmd *cobra.Command) {
+			test := &cobra.Command{
+				Use:   "test [--config <path>] [--adapter <name>] [--domain <name>] <provider>",
+				Short: "Checks the connection and credentials of a provider",
+				Args:  cobra.ExactArgs(1),
+				RunE:  caddycmd.WrapCommandFuncForCobra(cmdTest),
+			}
+			test.Flags().StringP("config", "c", "", "Configuration file")
+			test.Flags().StringP("adapter", "a", "", "Name of config adapter to apply")
+			test.Flags().StringP("domain", "d", "", "Domain to look up")
+			cmd.AddCommand(test)
+		},
+	})
+}
+
+func cmdTest(fl caddycmd.Flags) (int, error) {
+	name := fl.Arg(0)
+
+	app, err := loadApp(fl.String("config"), fl.String("adapter"))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	config, exists := app.Providers[name]
+	if !exists {
+		names := make([]string, 0, len(app.Providers))
+		for configured := range app.Providers {
+			names = append(names, configured)
+		}
+		sort.Strings(names)
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("provider %s not found in the local_dns app, configured: %s", name, strings.Join(names, ", "))
+	}
+
+	config.expandPlaceholders(caddy.NewReplacer())
+	app.logger = caddy.Log().Named("local_dns")
+	client, err := app.createProvider(config)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("failed to create provider %s: %w", name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if err := client.Validate(ctx); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("provider %s (%s): connection failed: %w", name, config.Type, err)
+	}
+	fmt.Printf("provider %s (%s): connection OK\n", name, config.Type)
+
+	domain := fl.String("domain")
+	if domain == "" {
+		domain = testDomain(config)
+	}
+	records, err := client.FindRecord(ctx, domain)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("provider %s (%s): lookup of %s failed: %w", name, config.Type, domain, err)
+	}
+	fmt.Printf("provider %s (%s): lookup of %s OK, %d record(s)\n", name, config.Type, domain, len(records))
+	for _, record := range records {
+		fmt.Printf("  %s %s %s (enabled: %t)\n", record.Domain, record.RecordType, record.Value, record.Enabled)
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+// loadApp returns the local_dns app of the config, adapted like caddy run
+// does it
+func loadApp(configFile, adapter string) (*App, error) {
+	cfgJSON, _, err := caddycmd.LoadConfig(configFile, adapter)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfgJSON) == 0 {
+		return nil, errors.New("no config found, use --config")
+	}
+
+	var cfg struct {
+		Apps map[string]json.RawMessage `json:"apps"`
+	}
+	if err := json.Unmarshal(cfgJSON, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	raw, exists := cfg.Apps["local_dns"]
+	if !exists {
+		return nil, errors.New("the config has no local_dns app")
+	}
+
+	app := new(App)
+	if err := json.Unmarshal(raw, app); err != nil {
+		return nil, fmt.Errorf("failed to parse the local_dns app: %w", err)
+	}
+	return app, nil
+}
+
+// testDomain returns the domain looked up by default, within the zone of
+// the provider if it has one
+func testDomain(config *ProviderConfig) string {
+	zone := config.Zone
+	if zone == "" && len(config.Zones) > 0 {
+		zone = config.Zones[0]
+	}
+	if zone == "" {
+		zone = "example.com"
+	}
+	return "local-dns-test." + strings.TrimSuffix(zone, ".")
+}
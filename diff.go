@@ -0,0 +1,208 @@
+package local_dns
+
+import (
+	"context"
+	"sort"
+
+	"github.com/mietzen/caddy-local-dns/provider"
+)
+
+// RecordDiff compares the desired records of one name and type with those
+// of a provider
+type RecordDiff struct {
+	Domain     string   `json:"domain"`
+	RecordType string   `json:"record_type,omitempty"`
+	Provider   string   `json:"provider"`
+	Desired    []string `json:"desired,omitempty"`
+	Actual     []string `json:"actual,omitempty"`
+	Wildcard   string   `json:"wildcard,omitempty"` // covering the domain with respect_wildcards
+	Status     string   `json:"status"`             // see diffStatus, "covered", "kept", "delete" or "error"
+	Error      string   `json:"error,omitempty"`
+}
+
+// Diff looks up the records of every domain seen so far and of the static
+// domains and compares them with the records reconciling would sync, sorted
+// by domain. Nothing is changed. Lookups bypass the cache, so changes made
+// on the DNS server show up right away.
+func (a *App) Diff(ctx context.Context) []RecordDiff {
+	ctx = provider.WithoutCache(ctx)
+
+	a.mu.Lock()
+	items := append([]queuedDomain(nil), a.static...)
+	for _, item := range a.seen {
+		items = append(items, item)
+	}
+	a.mu.Unlock()
+
+	checked := make(map[string]bool)
+	var diffs []RecordDiff
+	for _, item := range items {
+		h := item.handler
+		for _, name := range h.requestNames(item.domain) {
+			name = normalizeDomain(name)
+			if checked[name] {
+				continue
+			}
+			if _, ignored := a.ignored(name); ignored {
+				continue
+			}
+			if _, excluded := h.excluded(name); excluded || !h.allowed(name) {
+				continue
+			}
+			checked[name] = true
+			diffs = append(diffs, h.diffDomain(ctx, name, item.ip)...)
+		}
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool {
+		if diffs[i].Domain != diffs[j].Domain {
+			return diffs[i].Domain < diffs[j].Domain
+		}
+		if diffs[i].Provider != diffs[j].Provider {
+			return diffs[i].Provider < diffs[j].Provider
+		}
+		return diffs[i].RecordType < diffs[j].RecordType
+	})
+	return diffs
+}
+
+// diffDomain compares the records of domain, its SRV and PTR records
+// included, with the providers reconcileDomain would sync. With failover
+// that is the first provider it would try.
+func (h *Handler) diffDomain(ctx context.Context, domain, ip string) []RecordDiff {
+	if h.Tag != "" {
+		ctx = provider.WithTag(ctx, h.tag(domain))
+	}
+
+	providers := h.domainProviders(domain)
+	if h.Failover && len(providers) > 0 {
+		providers = h.failoverOrder(providers, domain)[:1]
+	}
+
+	desired, err := h.desiredRecords(domain, ip)
+	var diffs []RecordDiff
+	for _, providerName := range providers {
+		if err != nil {
+			diffs = append(diffs, RecordDiff{Domain: domain, Provider: providerName, Status: "error", Error: err.Error()})
+			continue
+		}
+
+		diffs = append(diffs, h.diff(ctx, providerName, domain, desired)...)
+		if srvName, srv, ok := h.srvRecord(domain); ok {
+			diffs = append(diffs, h.diff(ctx, providerName, srvName, []desiredRecord{srv})...)
+		}
+		if h.CreatePTR && !provider.IsWildcard(domain) {
+			for _, record := range desired {
+				if record.RecordType != "A" && record.RecordType != "AAAA" {
+					continue
+				}
+				if name, ok := h.reverseName(providerName, record.Value); ok {
+					diffs = append(diffs, h.diff(ctx, providerName, name, []desiredRecord{{RecordType: "PTR", Value: domain}})...)
+				}
+			}
+		}
+	}
+	return diffs
+}
+
+// diff compares the desired records of domain with those of the provider,
+// one entry per record type, like syncProvider would reconcile them
+func (h *Handler) diff(ctx context.Context, providerName, domain string, desired []desiredRecord) []RecordDiff {
+	failed := func(err error) []RecordDiff {
+		return []RecordDiff{{Domain: domain, Provider: providerName, Status: "error", Error: err.Error()}}
+	}
+
+	client := h.app.clients[providerName]
+	existing, err := client.FindRecord(ctx, domain)
+	if err != nil {
+		return failed(err)
+	}
+
+	// Desired values by type, in the order of desiredRecords
+	var types []string
+	values := make(map[string][]string)
+	for _, record := range desired {
+		if _, exists := values[record.RecordType]; !exists {
+			types = append(types, record.RecordType)
+		}
+		if !containsRecordValue(record.RecordType, values[record.RecordType], record.Value) {
+			values[record.RecordType] = append(values[record.RecordType], record.Value)
+		}
+	}
+
+	var wildcard string
+	if h.Mode != "delete" && h.RespectWildcards && len(existing) == 0 {
+		var covered bool
+		if wildcard, covered, err = h.coveredByWildcard(ctx, client, domain, desired); err != nil {
+			return failed(err)
+		}
+		if !covered {
+			wildcard = ""
+		}
+	}
+
+	var diffs []RecordDiff
+	for _, recordType := range types {
+		var actual []string
+		var current []*provider.DNSRecord
+		for _, record := range existing {
+			if record.RecordType == recordType {
+				actual = append(actual, record.Value)
+				current = append(current, record)
+			}
+		}
+		diff := RecordDiff{Domain: domain, RecordType: recordType, Provider: providerName, Actual: actual}
+
+		if h.Mode == "delete" {
+			// Records of deleted domains must be gone
+			if len(actual) > 0 {
+				diff.Status = "delete"
+				diffs = append(diffs, diff)
+			}
+			continue
+		}
+
+		diff.Desired = values[recordType]
+		switch {
+		case wildcard != "":
+			// syncProvider doesn't create records a wildcard already provides
+			diff.Wildcard = wildcard
+			diff.Status = "covered"
+		default:
+			diff.Status = diffStatus(recordType, diff.Desired, current, !h.Disabled)
+			if diff.Status != "ok" && len(current) > 0 && h.CreateOnly {
+				// create_only leaves existing records alone
+				diff.Status = "kept"
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// diffStatus reports whether current matches desired and enabled, lacks all
+// values ("missing"), has other values ("mismatch") or only another enabled
+// state ("state")
+func diffStatus(recordType string, desired []string, current []*provider.DNSRecord, enabled bool) string {
+	if len(current) == 0 {
+		return "missing"
+	}
+	if len(current) != len(desired) {
+		return "mismatch"
+	}
+	var actual []string
+	for _, record := range current {
+		actual = append(actual, record.Value)
+	}
+	for _, value := range desired {
+		if !containsRecordValue(recordType, actual, value) {
+			return "mismatch"
+		}
+	}
+	for _, record := range current {
+		if record.Enabled != enabled {
+			return "state"
+		}
+	}
+	return "ok"
+}
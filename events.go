@@ -0,0 +1,65 @@
+package local_dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// webhookTimeout bounds each webhook delivery
+const webhookTimeout = 10 * time.Second
+
+// recordEvent is posted to the webhook after a record changed
+type recordEvent struct {
+	Domain     string `json:"domain"`
+	IP         string `json:"ip"` // record value, the target for CNAME records
+	RecordType string `json:"record_type"`
+	Provider   string `json:"provider"`
+	Action     string `json:"action"`       // "create", "update" or "delete"
+	ID         string `json:"id,omitempty"` // assigned by the provider, if it has IDs
+
+	// Previous holds the values replaced by an update
+	Previous []string `json:"previous,omitempty"`
+}
+
+// notify delivers event to the webhook in the background. Failures are
+// only logged, record changes never wait for the webhook.
+func (a *App) notify(event recordEvent) {
+	if a.webhook == nil {
+		return
+	}
+
+	go func() {
+		if err := a.postEvent(event); err != nil {
+			a.logger.Warn("failed to deliver webhook",
+				zap.String("domain", event.Domain),
+				zap.String("action", event.Action),
+				zap.Error(err))
+		}
+	}()
+}
+
+func (a *App) postEvent(event recordEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.webhook.Post(a.WebhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	if a.Debug {
+		a.logger.Debug("webhook delivered", zap.String("domain", event.Domain), zap.String("action", event.Action))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package local_dns
+
+import (
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxExpireInterval bounds the time between two idle record sweeps
+const maxExpireInterval = time.Minute
+
+// requestNames returns the names that get records for a request of domain:
+// the domain itself, the aliases and the prefixed names
+func (h *Handler) requestNames(domain string) []string {
+	names := []string{normalizeDomain(domain)}
+	for _, alias := range h.Alias {
+		names = append(names, normalizeDomain(alias))
+	}
+	return append(names, h.prefixedNames(domain)...)
+}
+
+// domainsRequested refreshes the request time of the managed records
+// belonging to names
+func (a *App) domainsRequested(names []string) {
+	belongs := make(map[string]bool, len(names))
+	for _, name := range names {
+		belongs[name] = true
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, record := range a.managed {
+		if recordOf(key, record, belongs) {
+			record.LastSeen = now
+		}
+	}
+}
+
+// recordOf reports whether the managed record belongs to one of names
+func recordOf(key managedKey, record *managedRecord, names map[string]bool) bool {
+	owner := recordOwner(key, record.Value)
+	return owner != "" && names[owner]
+}
+
+// recordOwner returns the name a managed record was created for. SRV
+// records live below the name, PTR records point at it.
+func recordOwner(key managedKey, value string) string {
+	domain := normalizeDomain(key.Domain)
+	switch key.RecordType {
+	case "SRV":
+		// _service._proto.<name>
+		parts := strings.SplitN(domain, ".", 3)
+		if len(parts) != 3 {
+			return ""
+		}
+		return parts[2]
+	case "PTR":
+		return normalizeDomain(value)
+	default:
+		return domain
+	}
+}
+
+// expireLoop deletes idle records until stopped
+func (a *App) expireLoop(timeout time.Duration) {
+	ticker := time.NewTicker(min(timeout, maxExpireInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.expireStop:
+			return
+		case <-ticker.C:
+			a.expireIdle(timeout)
+		}
+	}
+}
+
+// expireIdle deletes the managed records whose domain wasn't requested
+// within timeout. Domains registered at startup are kept.
+func (a *App) expireIdle(timeout time.Duration) {
+	static := make(map[string]bool)
+	for _, item := range a.static {
+		for _, name := range item.handler.requestNames(item.domain) {
+			static[name] = true
+		}
+	}
+
+	type idleRecord struct {
+		key      managedKey
+		value    string
+		lastSeen time.Time
+	}
+	var idle []idleRecord
+	a.mu.Lock()
+	for key, record := range a.managed {
+		if time.Since(record.LastSeen) > timeout && !recordOf(key, record, static) {
+			idle = append(idle, idleRecord{key: key, value: record.Value, lastSeen: record.LastSeen})
+		}
+	}
+	a.mu.Unlock()
+
+	if a.Debug {
+		a.logger.Debug("checked for idle records", zap.Int("idle", len(idle)))
+	}
+
+	expired := make(map[string]bool)
+	for _, record := range idle {
+		client, exists := a.clients[record.key.Provider]
+		if !exists {
+			continue
+		}
+
+		// Reconciling a request of the domain waits for the lock, so a
+		// request after the check below gets its record back
+		unlock := a.lockDomain(recordOwner(record.key, record.value))
+		a.mu.Lock()
+		current, tracked := a.managed[record.key]
+		requested := !tracked || time.Since(current.LastSeen) <= timeout
+		a.mu.Unlock()
+		if requested {
+			unlock()
+			continue
+		}
+		err := client.DeleteRecord(a.ctx, record.key.Domain, record.key.RecordType)
+		unlock()
+		if err != nil {
+			a.logger.Error("failed to delete idle DNS record",
+				zap.String("domain", record.key.Domain),
+				zap.String("record_type", record.key.RecordType),
+				zap.String("provider", record.key.Provider),
+				zap.Error(err))
+			continue
+		}
+
+		a.logger.Info("deleted idle DNS record",
+			zap.String("domain", record.key.Domain),
+			zap.String("record_type", record.key.RecordType),
+			zap.String("value", record.value),
+			zap.String("provider", record.key.Provider),
+			zap.Time("last_seen", record.lastSeen))
+		a.recordDeleted(record.key.Provider, record.key.Domain, record.key.RecordType, record.value)
+		expired[normalizeDomain(record.key.Domain)] = true
+	}
+
+	// reconcile_interval must not bring them back
+	a.mu.Lock()
+	for item := range a.seen {
+		if expired[normalizeDomain(item.domain)] {
+			delete(a.seen, item)
+		}
+	}
+	a.mu.Unlock()
+
+	// Keep the request times of the remaining records
+	a.saveState()
+}
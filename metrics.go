@@ -0,0 +1,143 @@
+package local_dns
+
+import (
+	"context"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/mietzen/caddy-local-dns/provider"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics holds the Prometheus collectors of the local_dns app. A nil
+// *metrics is valid and records nothing, so callers need no checks.
+type metrics struct {
+	recordsCreated  *prometheus.CounterVec
+	recordsUpdated  *prometheus.CounterVec
+	providerErrors  *prometheus.CounterVec
+	providerLatency *prometheus.HistogramVec
+}
+
+// newMetrics creates the collectors and registers them with the metrics
+// registry of ctx. Every config load gets a fresh registry.
+func newMetrics(ctx caddy.Context) (*metrics, error) {
+	const ns = "local_dns"
+
+	m := &metrics{
+		recordsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "records_created_total",
+			Help:      "Number of DNS records created.",
+		}, []string{"provider", "type"}),
+		recordsUpdated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "records_updated_total",
+			Help:      "Number of DNS records updated.",
+		}, []string{"provider", "type"}),
+		providerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "provider_errors_total",
+			Help:      "Number of failed provider calls.",
+		}, []string{"provider", "operation"}),
+		providerLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "provider_request_duration_seconds",
+			Help:      "Latency of provider calls.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"provider", "operation"}),
+	}
+
+	registry := ctx.GetMetricsRegistry()
+	for _, c := range []prometheus.Collector{m.recordsCreated, m.recordsUpdated, m.providerErrors, m.providerLatency} {
+		if err := registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *metrics) recordCreated(providerName, recordType string) {
+	if m != nil {
+		m.recordsCreated.WithLabelValues(providerName, recordType).Inc()
+	}
+}
+
+func (m *metrics) recordUpdated(providerName, recordType string) {
+	if m != nil {
+		m.recordsUpdated.WithLabelValues(providerName, recordType).Inc()
+	}
+}
+
+// observe records the latency and outcome of a provider call started at start
+func (m *metrics) observe(providerName, operation string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.providerLatency.WithLabelValues(providerName, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.providerErrors.WithLabelValues(providerName, operation).Inc()
+	}
+}
+
+// instrumentedService wraps a DNSService and reports every call to metrics
+type instrumentedService struct {
+	inner   provider.DNSService
+	name    string
+	metrics *metrics
+}
+
+func (s *instrumentedService) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	start := time.Now()
+	err := s.inner.CreateRecord(ctx, domain, recordType, value)
+	s.metrics.observe(s.name, "create", start, err)
+	return err
+}
+
+func (s *instrumentedService) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	start := time.Now()
+	err := s.inner.DeleteRecord(ctx, domain, recordType)
+	s.metrics.observe(s.name, "delete", start, err)
+	return err
+}
+
+func (s *instrumentedService) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	start := time.Now()
+	err := s.inner.UpdateRecord(ctx, domain, recordType, value)
+	s.metrics.observe(s.name, "update", start, err)
+	return err
+}
+
+func (s *instrumentedService) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	start := time.Now()
+	err := provider.SetEnabled(ctx, s.inner, domain, recordType, enabled)
+	s.metrics.observe(s.name, "set_enabled", start, err)
+	return err
+}
+
+func (s *instrumentedService) FindRecord(ctx context.Context, domain string) ([]*provider.DNSRecord, error) {
+	start := time.Now()
+	records, err := s.inner.FindRecord(ctx, domain)
+	s.metrics.observe(s.name, "find", start, err)
+	return records, err
+}
+
+func (s *instrumentedService) ListRecords(ctx context.Context) ([]*provider.DNSRecord, error) {
+	start := time.Now()
+	records, err := provider.ListRecords(ctx, s.inner)
+	s.metrics.observe(s.name, "list", start, err)
+	return records, err
+}
+
+func (s *instrumentedService) Validate(ctx context.Context) error {
+	start := time.Now()
+	err := s.inner.Validate(ctx)
+	s.metrics.observe(s.name, "validate", start, err)
+	return err
+}
+
+// Interface compliance
+var (
+	_ provider.DNSService = (*instrumentedService)(nil)
+	_ provider.Toggler    = (*instrumentedService)(nil)
+	_ provider.Lister     = (*instrumentedService)(nil)
+)
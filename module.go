@@ -1,17 +1,28 @@
 package local_dns
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"github.com/mietzen/caddy-local-dns/provider"
 	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
 )
 
 func init() {
@@ -22,30 +33,429 @@ func init() {
 // App is the global app that manages DNS providers
 type App struct {
 	Providers map[string]*ProviderConfig `json:"providers,omitempty"`
-	CaddyIP   string                     `json:"caddy_ip,omitempty"`
+	CaddyIP   []string                   `json:"caddy_ip,omitempty"`
 	Debug     bool                       `json:"debug,omitempty"`
 
-	logger  *zap.Logger
-	clients map[string]provider.DNSService
+	// DebugProviders enables debug logs of the providers, i.e. their
+	// settings, API calls and responses. Debug only covers the handling
+	// of domains, so those details stay out of the logs.
+	DebugProviders bool `json:"debug_providers,omitempty"`
+
+	// DefaultProvider is used by handlers that don't name a provider
+	DefaultProvider string `json:"default_provider,omitempty"`
+
+	// DetectIPTarget is the address dialed to detect the outbound IP
+	// when caddy_ip is "auto". Defaults to 8.8.8.8:80.
+	DetectIPTarget string `json:"detect_ip_target,omitempty"`
+
+	// CleanupOnStop deletes the records created or updated by this
+	// module when Caddy shuts down. Config reloads hand them over to the
+	// new config instead.
+	CleanupOnStop bool `json:"cleanup_on_stop,omitempty"`
+
+	// StateFile persists the records created or updated by this module as
+	// JSON, so cleanup_on_stop, max_records and the admin API still know
+	// them after a restart. Not persisted when empty.
+	StateFile string `json:"state_file,omitempty"`
+
+	// RecordIdleTimeout deletes managed records whose domain hasn't been
+	// requested for this long, e.g. hosts only probed by bots. Domains
+	// registered at startup never expire. Disabled when zero.
+	RecordIdleTimeout caddy.Duration `json:"record_idle_timeout,omitempty"`
+
+	// PruneStale deletes records created by this module for domains no
+	// longer served by the HTTP app, e.g. after a site was removed and
+	// Caddy reloaded. Runs at startup for providers that mark their
+	// records with a comment.
+	PruneStale bool `json:"prune_stale,omitempty"`
+
+	// MaxRecords caps the number of distinct domains records are created
+	// for, guarding the DNS server against junk from arbitrary Host
+	// headers. Existing records are still updated. Unlimited when zero.
+	MaxRecords int `json:"max_records,omitempty"`
+
+	// WorkerConcurrency is the number of workers reconciling queued
+	// domains in parallel. Defaults to 1, handling one domain at a time.
+	WorkerConcurrency int `json:"worker_concurrency,omitempty"`
+
+	// FailoverThreshold is the number of consecutive failures after which
+	// a provider is skipped by handlers with failover, for FailoverCooldown.
+	// Defaults to 3 failures and 1m.
+	FailoverThreshold int            `json:"failover_threshold,omitempty"`
+	FailoverCooldown  caddy.Duration `json:"failover_cooldown,omitempty"`
+
+	// RetryAttempts is the number of tries for each provider call.
+	// Values below 2 disable retries.
+	RetryAttempts int `json:"retry_attempts,omitempty"`
+	// RetryDelay is the delay before the first retry, doubled after each
+	// failure. Defaults to 1s.
+	RetryDelay caddy.Duration `json:"retry_delay,omitempty"`
+	// RetryMaxDelay caps the backoff delay. Defaults to 30s.
+	RetryMaxDelay caddy.Duration `json:"retry_max_delay,omitempty"`
+	// RateLimit caps the calls per second made to each provider, with a
+	// random jitter spreading them out. Unlimited when zero.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+
+	// CacheTTL is how long record lookups are cached per domain.
+	// Defaults to 60s, a negative value disables the cache.
+	CacheTTL caddy.Duration `json:"cache_ttl,omitempty"`
+
+	// Metrics enables Prometheus metrics for record operations.
+	Metrics bool `json:"metrics,omitempty"`
+
+	// SkipValidation disables the connectivity check of each provider
+	// during provisioning, e.g. for offline testing.
+	SkipValidation bool `json:"skip_validation,omitempty"`
+
+	// ReconcileInterval periodically re-checks every domain seen so far,
+	// correcting records changed out-of-band. Disabled when zero.
+	ReconcileInterval caddy.Duration `json:"reconcile_interval,omitempty"`
+
+	// DryRun logs record changes instead of applying them. Lookups still
+	// reach the providers.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// BatchWindow collects queued domains for this long and applies their
+	// changes together, so providers like OPNsense reload only once.
+	// Disabled when zero.
+	BatchWindow caddy.Duration `json:"batch_window,omitempty"`
+
+	// WebhookURL receives a JSON event after each record change
+	WebhookURL string `json:"webhook_url,omitempty"`
+
+	// IgnoreHosts lists hosts that never get records, using the syntax of
+	// a handler's exclude. Defaults to localhost and *.localhost. IP
+	// addresses are always ignored.
+	IgnoreHosts []string `json:"ignore_hosts,omitempty"`
+
+	logger   *zap.Logger
+	caddyCtx caddy.Context
+	clients  map[string]provider.DNSService
+	batchers map[string]provider.Batcher // unwrapped clients deferring changes
+	metrics  *metrics
+	webhook  *http.Client
+
+	// rawClients are the clients before decoration, reused on reload
+	// while their providerKeys match
+	rawClients   map[string]provider.DNSService
+	providerKeys map[string]string
+
+	mu          *sync.Mutex
+	managed     map[managedKey]*managedRecord
+	domainLocks map[string]*domainLock
+	health      map[string]*providerHealth // of providers used for failover
+	stateMu     *sync.Mutex                // serializes writes of the state file
+
+	queue    chan queuedDomain
+	pending  map[queuedDomain]bool         // queued or in progress
+	seen     map[queuedDomain]queuedDomain // last handled item by handler and domain, reconciled periodically
+	hosts    []string                      // configured, the only domains added to seen
+	static   []queuedDomain                // registered once at startup
+	aliases  []string                      // of all handlers, kept when pruning
+	handlers []*Handler                    // provisioned, to map hosts when pruning
+	stopped  bool
+	done     chan struct{}
+
+	reconcileStop chan struct{}
+	expireStop    chan struct{}
+
+	// ctx bounds background provider calls, it is cancelled on Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// queuedDomain is a domain waiting to be reconciled by a handler's provider
+type queuedDomain struct {
+	handler *Handler
+	domain  string
+	ip      string // comma-separated, taken from the request, empty for the configured IPs
+}
+
+// providerHealth tracks the failures of a provider used for failover
+type providerHealth struct {
+	failures  int       // consecutive
+	downUntil time.Time // skipped until then
+}
+
+// domainLock serializes reconciliation of one domain
+type domainLock struct {
+	mu   sync.Mutex
+	refs int // holders and waiters, the lock is dropped at zero
+}
+
+// managedKey identifies a record created or updated by this module
+type managedKey struct {
+	Provider   string
+	Domain     string
+	RecordType string
+}
+
+// managedRecord is the last known state of a managed record
+type managedRecord struct {
+	Value    string
+	ID       string // assigned by the provider, if it has IDs
+	LastSync time.Time
+	LastSeen time.Time // last request for the domain
 }
 
 // ProviderConfig holds the configuration for a DNS provider
 type ProviderConfig struct {
-	Type       string `json:"type"` // "opnsense", "pihole", etc.
+	Type       string `json:"type"` // "opnsense", "pihole", "technitium", "dnsmasq", "adguard", "powerdns", "rfc2136", "nsupdate", "knot", "cloudflare", "nextdns", "mikrotik", "unifi", "coredns-etcd", "hostsfile", "webhook", "memory"
 	Hostname   string `json:"hostname,omitempty"`
 	APIKey     string `json:"api_key,omitempty"`
 	APISecret  string `json:"api_secret,omitempty"`
 	DNSService string `json:"dns_service,omitempty"` // "unbound", "dnsmasq", etc.
 	Insecure   bool   `json:"insecure,omitempty"`
+	TTL        int    `json:"ttl,omitempty"` // seconds, 0 keeps the provider default
+
+	// CACert is a PEM file with the CA certificates trusted for the
+	// provider's API instead of the system roots.
+	CACert string `json:"ca_cert,omitempty"`
+
+	// SkipHostnameVerify accepts certificates that chain to a trusted CA
+	// but don't match the hostname, e.g. when connecting by IP.
+	SkipHostnameVerify bool `json:"skip_hostname_verify,omitempty"`
+
+	// ReconfigureDelay debounces reloading the DNS service (OPNsense), so
+	// changes made in quick succession cause a single reload.
+	ReconfigureDelay caddy.Duration `json:"reconfigure_delay,omitempty"`
+
+	// AuthMode sends api_key and api_secret as "basic" auth (default), in
+	// "header"s or as "query" parameters, e.g. for a proxy in front of the
+	// API (OPNsense).
+	AuthMode string `json:"auth_mode,omitempty"`
+
+	// AutoApply reconfigures the DNS service after changes (OPNsense).
+	// When false, changes are only staged and applied by the operator.
+	// Defaults to true.
+	AutoApply *bool `json:"auto_apply,omitempty"`
+
+	// AwaitApply waits up to this long after each created or updated
+	// record until the provider returns it, so the change is live once
+	// handled (e.g. OPNsense applies changes asynchronously). The lookup is
+	// repeated every AwaitInterval, 1s by default. Disabled when zero.
+	AwaitApply    caddy.Duration `json:"await_apply,omitempty"`
+	AwaitInterval caddy.Duration `json:"await_interval,omitempty"`
+
+	// UserAgent and Headers are sent with each request (OPNsense, webhook),
+	// e.g. for an API gateway in front of the DNS server. The User-Agent
+	// defaults to caddy-local-dns/<version>.
+	UserAgent string            `json:"user_agent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+
+	// Connection pool of the API client (OPNsense): the idle connections
+	// kept to the host (default 16), how long they're kept (default 90s)
+	// and whether connections are reused at all (default true).
+	MaxIdleConns    int            `json:"max_idle_conns,omitempty"`
+	IdleConnTimeout caddy.Duration `json:"idle_conn_timeout,omitempty"`
+	KeepAlive       *bool          `json:"keep_alive,omitempty"`
+
+	// Comment is the description of created records (OPNsense), "{domain}"
+	// is replaced with the record's domain.
+	Comment string `json:"comment,omitempty"`
+
+	// Timeout bounds each request to the provider. Defaults to 10s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	// Zone is the zone records are managed in (PowerDNS, RFC 2136, Knot)
+	Zone string `json:"zone,omitempty"`
+
+	// Zones restricts the provider to domains within these zones, e.g. to
+	// keep public domains out of a Pi-hole. All domains are accepted when
+	// empty.
+	Zones []string `json:"zones,omitempty"`
+
+	// Cloudflare zone and whether records are proxied instead of DNS-only
+	ZoneID  string `json:"zone_id,omitempty"`
+	Proxied bool   `json:"proxied,omitempty"`
+
+	// ProfileID is the NextDNS profile whose rewrites are managed
+	ProfileID string `json:"profile_id,omitempty"`
+
+	// Site is the UniFi site records are managed in, defaults to "default"
+	Site string `json:"site,omitempty"`
+
+	// Settings of the CoreDNS etcd provider: the etcd endpoints, the path
+	// below which the plugin reads records (default "/skydns") and an
+	// optional client certificate. api_key and api_secret are the etcd
+	// user and password.
+	Endpoints  []string `json:"endpoints,omitempty"`
+	Prefix     string   `json:"prefix,omitempty"`
+	ClientCert string   `json:"client_cert,omitempty"`
+	ClientKey  string   `json:"client_key,omitempty"`
+
+	// TSIG settings of the RFC 2136 provider
+	TSIGKey       string `json:"tsig_key,omitempty"`
+	TSIGSecret    string `json:"tsig_secret,omitempty"` // base64
+	TSIGAlgorithm string `json:"tsig_algorithm,omitempty"`
+
+	// Settings of the nsupdate provider
+	KeyFile      string `json:"key_file,omitempty"`      // passed to nsupdate -k
+	NsupdatePath string `json:"nsupdate_path,omitempty"` // default: nsupdate from PATH
+
+	// Settings of the Knot provider
+	KnotSocket string `json:"knot_socket,omitempty"` // control socket, passed to knotc -s
+	KnotcPath  string `json:"knotc_path,omitempty"`  // default: knotc from PATH
+
+	// SSH settings of the standalone dnsmasq provider
+	SSHUser    string `json:"ssh_user,omitempty"`
+	SSHKey     string `json:"ssh_key,omitempty"` // path to the private key
+	KnownHosts string `json:"known_hosts,omitempty"`
+	HostsFile  string `json:"hosts_file,omitempty"` // addn-hosts file on the remote host, or the local file of hostsfile
 }
 
 // Handler is the HTTP handler that processes individual site configurations
 type Handler struct {
-	Provider   string `json:"provider,omitempty"`
-	IPOverride string `json:"ip_override,omitempty"`
+	// Providers receive the records of this site, each independently
+	Providers []string `json:"providers,omitempty"`
+
+	// IPOverride replaces the global caddy_ip. Values may contain
+	// placeholders, e.g. {env.APP_IP} or {http.vars.ip}, which are resolved
+	// per request.
+	IPOverride []string `json:"ip_override,omitempty"`
+
+	// Wildcard registers *.<parent> instead of the concrete host,
+	// e.g. *.example.com for app.example.com.
+	Wildcard bool `json:"wildcard,omitempty"`
+
+	// CNAME creates a CNAME record pointing at this target instead of
+	// address records.
+	CNAME string `json:"cname,omitempty"`
+
+	// UseForwardedHost takes the domain from the X-Forwarded-Host header
+	// when present. Only enable it behind a trusted proxy.
+	UseForwardedHost bool `json:"use_forwarded_host,omitempty"`
+
+	// PreferSNI takes the domain from the TLS server name instead of the
+	// Host header when present. Plaintext requests use the Host header.
+	PreferSNI bool `json:"prefer_sni,omitempty"`
+
+	// DomainOverride is registered instead of the requested host, e.g. a
+	// public name for a site matched by an internal one. Placeholders
+	// like {http.request.host} are replaced per request, the result must
+	// be a host name. Takes precedence over use_forwarded_host and
+	// prefer_sni.
+	DomainOverride string `json:"domain_override,omitempty"`
+
+	// RequireApp fails startup if the global local_dns app isn't
+	// configured. By default the handler logs a warning and passes requests
+	// on, so one site can't take down the server.
+	RequireApp bool `json:"require_app,omitempty"`
+
+	// RegisteredDomain registers the registrable domain (eTLD+1) of the
+	// host, e.g. example.com for a.b.example.com, using the public suffix
+	// list. PrivateSuffixes are treated as suffixes too, e.g. "home.arpa"
+	// or "corp.internal", so a.b.corp.internal registers b.corp.internal.
+	RegisteredDomain bool     `json:"registered_domain,omitempty"`
+	PrivateSuffixes  []string `json:"private_suffixes,omitempty"`
+
+	// RewriteDomain transforms the host with a regular expression before
+	// it is registered, e.g. to strip a preview- prefix.
+	RewriteDomain *DomainRewrite `json:"rewrite_domain,omitempty"`
+
+	// Exclude lists domains that are never registered. A leading "*."
+	// matches all subdomains, other patterns use glob syntax.
+	Exclude []string `json:"exclude,omitempty"`
+
+	// AllowedPattern restricts registration to matching domains, so spoofed
+	// Host headers can't create records. Patterns use the syntax of
+	// exclude, a leading "~" makes the rest a regular expression matching
+	// the whole domain. All domains are allowed when empty.
+	AllowedPattern []string `json:"allowed_pattern,omitempty"`
+
+	// OnError is "continue" (default) to reconcile in the background and
+	// only log failures, or "fail" to reconcile during the request and
+	// answer 502 Bad Gateway when it fails.
+	OnError string `json:"on_error,omitempty"`
+
+	// TXT creates a TXT record with this value next to the address records.
+	// "{domain}" and "{ip}" are replaced with the domain and its addresses.
+	TXT string `json:"txt,omitempty"`
+
+	// Tag is appended to the description of the records written for this
+	// site, e.g. the app name, where the provider supports descriptions.
+	// "{domain}" and global placeholders like {env.*} are replaced.
+	Tag string `json:"tag,omitempty"`
+
+	// Failover treats Providers as an ordered chain: records go to the
+	// first healthy provider only, the next one is tried when it fails.
+	// Providers failing repeatedly are skipped for failover_cooldown.
+	Failover bool `json:"failover,omitempty"`
+
+	// CreatePTR additionally creates a PTR record for each address, named
+	// after it in in-addr.arpa or ip6.arpa and pointing at the domain.
+	// Providers that can't hold the reverse name or PTR records skip it.
+	CreatePTR bool `json:"create_ptr,omitempty"`
+
+	// Disabled keeps the records disabled, e.g. to pre-stage them. Only
+	// providers that can disable records support it.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// RequireTLS only registers domains of requests received over TLS,
+	// so hosts Caddy couldn't get a certificate for are skipped.
+	RequireTLS bool `json:"require_tls,omitempty"`
+
+	// IPFromHeader names a request header holding the IP to register. It
+	// takes precedence over ip_override and caddy_ip, which are used when
+	// the header is missing or invalid. Only use headers set by a trusted
+	// upstream.
+	IPFromHeader string `json:"ip_from_header,omitempty"`
+
+	// Domains are registered once at startup, independent of requests.
+	// Useful for hosts that are served by other protocols.
+	Domains []string `json:"domains,omitempty"`
+
+	// Alias lists extra names that get the same records as the domain of
+	// each request, e.g. a short internal name for a site.
+	Alias []string `json:"alias,omitempty"`
+
+	// Prefixes register <prefix>.<domain> next to the domain of each
+	// request, e.g. "api" and "admin" for apps behind the same site.
+	Prefixes []string `json:"prefixes,omitempty"`
+
+	// RecordType limits the address records to "A" or "AAAA". The default
+	// "auto" registers every configured address.
+	RecordType string `json:"record_type,omitempty"`
+
+	// DebugHeaders adds X-Local-DNS-Domain, X-Local-DNS-IP and
+	// X-Local-DNS-Action response headers showing what was done. Records
+	// reconciled in the background are reported as "queued".
+	DebugHeaders bool `json:"debug_headers,omitempty"`
+
+	// Mode is "create" (default) to register domains or "delete" to remove
+	// their records, e.g. for a decommissioned site.
+	Mode string `json:"mode,omitempty"`
+
+	// CreateOnly creates missing records but leaves existing ones alone,
+	// e.g. when they are edited by hand afterwards. Differences are only
+	// logged.
+	CreateOnly bool `json:"create_only,omitempty"`
+
+	// SRV additionally registers an SRV record for the service pointing at
+	// the domain
+	SRV *SRVConfig `json:"srv,omitempty"`
+
+	// RespectWildcards skips domains already answered by a wildcard record
+	// of the parent with the desired values, e.g. app.example.com when
+	// *.example.com points at the right IP. Only applies while no record of
+	// the domain itself exists.
+	RespectWildcards bool `json:"respect_wildcards,omitempty"`
+
+	// SplitHorizon chooses the IPs by the client address of the request,
+	// e.g. to register the LAN address for internal clients and a public
+	// one for everyone else. The first matching rule wins, ip_override and
+	// caddy_ip are used when none matches. ip_from_header takes precedence.
+	SplitHorizon []*SplitHorizonRule `json:"split_horizon,omitempty"`
+
+	// OnlyOn limits registration to requests with certain methods or
+	// paths, e.g. to skip health check probes. It applies after the
+	// request matcher of the directive, unmatched requests are passed on.
+	OnlyOn *OnlyOnConfig `json:"only_on,omitempty"`
 
 	logger *zap.Logger
 	app    *App
+
+	allowedRegexps []*regexp.Regexp // compiled "~" patterns of allowed_pattern
 }
 
 // App methods
@@ -58,20 +468,149 @@ func (App) CaddyModule() caddy.ModuleInfo {
 
 func (a *App) Provision(ctx caddy.Context) error {
 	a.logger = ctx.Logger(a)
+	a.caddyCtx = ctx
 	a.clients = make(map[string]provider.DNSService)
+	a.batchers = make(map[string]provider.Batcher)
+	a.rawClients = make(map[string]provider.DNSService)
+	a.providerKeys = make(map[string]string)
+	a.mu = new(sync.Mutex)
+	a.stateMu = new(sync.Mutex)
+	a.managed = make(map[managedKey]*managedRecord)
+	a.domainLocks = make(map[string]*domainLock)
+	a.health = make(map[string]*providerHealth)
+	a.queue = make(chan queuedDomain, queueSize)
+	a.pending = make(map[queuedDomain]bool)
+	a.seen = make(map[queuedDomain]queuedDomain)
+	a.done = make(chan struct{})
+	a.ctx, a.cancel = context.WithCancel(ctx)
+
+	// Resolve "auto" to the primary outbound IPv4 and CIDR ranges to the
+	// address of a local interface
+	for i, ip := range a.CaddyIP {
+		switch {
+		case ip == "auto":
+			target := a.DetectIPTarget
+			if target == "" {
+				target = defaultDetectIPTarget
+			}
+			detected, err := detectOutboundIP(target)
+			if err != nil {
+				return fmt.Errorf("failed to detect caddy_ip, set an explicit IP instead: %w", err)
+			}
+			a.logger.Info("detected caddy_ip", zap.String("ip", detected), zap.String("target", target))
+			a.CaddyIP[i] = detected
+		case strings.Contains(ip, "/"):
+			resolved, err := interfaceIPInRange(ip)
+			if err != nil {
+				return fmt.Errorf("failed to resolve caddy_ip %s: %w", ip, err)
+			}
+			a.logger.Info("resolved caddy_ip", zap.String("ip", resolved), zap.String("range", ip))
+			a.CaddyIP[i] = resolved
+		default:
+			// IPv4-mapped IPv6 addresses become plain IPv4 (A records)
+			if parsed := net.ParseIP(ip); parsed != nil {
+				a.CaddyIP[i] = parsed.String()
+			}
+		}
+	}
 
 	// Validate global caddy_ip
-	if a.CaddyIP != "" {
-		if net.ParseIP(a.CaddyIP) == nil {
-			return fmt.Errorf("invalid caddy_ip address: %s", a.CaddyIP)
+	if err := validateIPs(a.CaddyIP); err != nil {
+		return fmt.Errorf("invalid caddy_ip: %w", err)
+	}
+
+	if a.WebhookURL != "" {
+		a.WebhookURL = caddy.NewReplacer().ReplaceKnown(a.WebhookURL, "")
+		a.webhook = &http.Client{Timeout: webhookTimeout}
+	}
+
+	for _, pattern := range a.IgnoreHosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid ignore_hosts pattern %s: %w", pattern, err)
 		}
 	}
 
+	if a.Metrics {
+		m, err := newMetrics(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to register metrics: %w", err)
+		}
+		a.metrics = m
+	}
+
+	// The Caddyfile rejects these while parsing, JSON configs only get here
+	if a.RetryAttempts < 0 || a.FailoverThreshold < 0 || a.MaxRecords < 0 || a.RateLimit < 0 || a.WorkerConcurrency < 0 {
+		return errors.New("retry_attempts, failover_threshold, max_records, rate_limit and worker_concurrency must not be negative")
+	}
+	for name, config := range a.Providers {
+		if config == nil || config.Type == "" {
+			return fmt.Errorf("provider %s requires a type", name)
+		}
+		if config.TTL < 0 {
+			return fmt.Errorf("invalid ttl %d of provider %s", config.TTL, name)
+		}
+		if config.MaxIdleConns < 0 {
+			return fmt.Errorf("invalid max_idle_conns %d of provider %s", config.MaxIdleConns, name)
+		}
+	}
+
+	if _, exists := a.Providers[a.DefaultProvider]; a.DefaultProvider != "" && !exists {
+		return fmt.Errorf("default_provider %s not found in providers", a.DefaultProvider)
+	}
+
 	// Initialize providers
+	repl := caddy.NewReplacer()
 	for name, config := range a.Providers {
-		client, err := a.createProvider(config)
-		if err != nil {
-			return fmt.Errorf("failed to create provider %s: %w", name, err)
+		config.expandPlaceholders(repl)
+
+		// On reload, only providers with changed settings (e.g. a rotated
+		// API key) get a new client
+		key := a.providerKey(config)
+		client, reused := reusableClient(name, key)
+		if reused {
+			if a.Debug {
+				a.logger.Debug("reusing DNS provider client, its config is unchanged", zap.String("name", name))
+			}
+		} else {
+			var err error
+			client, err = a.createProvider(config)
+			if err != nil {
+				return fmt.Errorf("failed to create provider %s: %w", name, err)
+			}
+			if !a.SkipValidation {
+				if err := client.Validate(ctx); err != nil {
+					return fmt.Errorf("failed to validate provider %s (use skip_validation to disable this check): %w", name, err)
+				}
+			}
+		}
+		a.rawClients[name] = client
+		a.providerKeys[name] = key
+		if batcher, ok := client.(provider.Batcher); ok {
+			a.batchers[name] = batcher
+		}
+		if config.AwaitApply > 0 {
+			client = provider.NewAwaitService(client, time.Duration(config.AwaitApply), time.Duration(config.AwaitInterval), a.logger)
+		}
+		if a.metrics != nil {
+			client = &instrumentedService{inner: client, name: name, metrics: a.metrics}
+		}
+		rateLimit := a.RateLimit
+		if rateLimit <= 0 && config.Type == "nextdns" {
+			// The NextDNS API throttles bursts, so it is always limited
+			rateLimit = provider.NextDNSRateLimit
+		}
+		if rateLimit > 0 {
+			// Below the retries, so every attempt is limited
+			client = provider.NewRateLimitedService(client, rateLimit)
+		}
+		if a.RetryAttempts > 1 {
+			client = a.withRetry(client)
+		}
+		if cacheTTL := a.cacheTTL(); cacheTTL > 0 {
+			client = provider.NewCachedService(client, cacheTTL)
+		}
+		if a.DryRun {
+			client = provider.NewDryRunService(client, name, a.logger)
 		}
 		a.clients[name] = client
 
@@ -80,130 +619,2414 @@ func (a *App) Provision(ctx caddy.Context) error {
 			zap.String("name", name),
 			zap.String("type", config.Type),
 		}
-		if a.Debug {
+		if a.DebugProviders {
 			fields = append(fields,
 				zap.String("hostname", config.Hostname),
 				zap.String("dns_service", config.DNSService),
 				zap.Bool("insecure", config.Insecure),
+				zap.Int("ttl", config.TTL),
 			)
 		}
-		a.logger.Info(logMsg, fields...)
+		a.logger.Info(logMsg, fields...)
+	}
+
+	// The running app's records are more recent than the state file
+	a.takeOverRecords(currentApp())
+	a.loadState()
+
+	return nil
+}
+
+func (a *App) Start() error {
+	a.markRunning()
+
+	// All apps are provisioned by now, so the routes are known
+	hosts, err := a.configuredHosts()
+	if err != nil {
+		a.logger.Warn("failed to collect configured hosts, only reconciling static domains periodically", zap.Error(err))
+	}
+	a.hosts = hosts
+
+	// done is closed once every worker has drained the queue
+	var workers sync.WaitGroup
+	for range max(a.WorkerConcurrency, 1) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			a.worker()
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(a.done)
+	}()
+
+	// Static domains are registered regardless of requests and then
+	// reconciled like any other seen domain
+	for _, item := range a.static {
+		a.enqueue(item.handler, item.domain, "")
+	}
+
+	if a.PruneStale {
+		go a.pruneStale()
+	}
+
+	if a.ReconcileInterval > 0 {
+		a.reconcileStop = make(chan struct{})
+		go a.reconcileLoop(time.Duration(a.ReconcileInterval))
+	}
+
+	if a.RecordIdleTimeout > 0 {
+		a.expireStop = make(chan struct{})
+		go a.expireLoop(time.Duration(a.RecordIdleTimeout))
+	}
+	return nil
+}
+
+func (a *App) Stop() error {
+	// On reload the new app is already running
+	successor := a.markStopped()
+
+	if a.reconcileStop != nil {
+		close(a.reconcileStop)
+	}
+	if a.expireStop != nil {
+		close(a.expireStop)
+	}
+
+	// Stop accepting domains and let the workers drain the queue. Calls
+	// still in progress after drainTimeout are aborted and the remaining
+	// domains dropped.
+	a.mu.Lock()
+	a.stopped = true
+	close(a.queue)
+	a.mu.Unlock()
+	drain := time.NewTimer(drainTimeout)
+	select {
+	case <-a.done:
+		drain.Stop()
+	case <-drain.C:
+		a.logger.Warn("queued domains not handled in time, dropping them", zap.Duration("timeout", drainTimeout))
+	}
+	a.cancel()
+	<-a.done
+
+	var errs []error
+	if successor != nil {
+		// Records written while draining are handed over as well instead
+		// of being deleted by cleanup_on_stop
+		successor.takeOverRecords(a)
+		successor.saveState()
+	} else if a.CleanupOnStop {
+		errs = append(errs, a.cleanup()...)
+	}
+	// Keeps the request times for record_idle_timeout
+	a.saveState()
+
+	// Apply changes still waiting for a debounced reload
+	for name, batcher := range a.batchers {
+		if err := batcher.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to apply pending changes of provider %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// cleanup deletes all managed records
+func (a *App) cleanup() []error {
+	// Provider calls can be slow, don't block the app meanwhile
+	a.mu.Lock()
+	managed := a.managed
+	a.managed = make(map[managedKey]*managedRecord)
+	a.mu.Unlock()
+
+	var errs []error
+	for key, record := range managed {
+		a.logger.Info("deleting managed DNS record",
+			zap.String("domain", key.Domain),
+			zap.String("record_type", key.RecordType),
+			zap.String("provider", key.Provider))
+		// a.ctx is already cancelled, only the provider timeouts apply
+		if err := a.clients[key.Provider].DeleteRecord(context.Background(), key.Domain, key.RecordType); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %s record for %s: %w", key.RecordType, key.Domain, err))
+			continue
+		}
+		a.notify(recordEvent{Domain: key.Domain, IP: record.Value, RecordType: key.RecordType, Provider: key.Provider, Action: "delete"})
+	}
+
+	return errs
+}
+
+// pruneStale deletes the records created by this module whose domain isn't
+// configured anymore
+func (a *App) pruneStale() {
+	hosts, err := a.configuredHosts()
+	if err != nil {
+		a.logger.Error("failed to collect configured hosts, not pruning stale records", zap.Error(err))
+		return
+	}
+	if len(hosts) == 0 {
+		// Sites without host matchers serve any domain
+		a.logger.Warn("no configured hosts found, not pruning stale records")
+		return
+	}
+
+	for name, client := range a.clients {
+		records, err := provider.ListRecords(a.ctx, client)
+		if errors.Is(err, provider.ErrListUnsupported) {
+			if a.Debug {
+				a.logger.Debug("provider can't list managed records, not pruning", zap.String("provider", name))
+			}
+			continue
+		}
+		if err != nil {
+			a.logger.Error("failed to list managed records", zap.String("provider", name), zap.Error(err))
+			continue
+		}
+
+		deleted := make(map[managedKey]bool)
+		for _, record := range records {
+			domain := normalizeDomain(record.Domain)
+			key := managedKey{Provider: name, Domain: domain, RecordType: record.RecordType}
+			owner := domain
+			if provider.IsReverseName(domain) {
+				// PTR records belong to the domain they point at
+				owner = normalizeDomain(record.Value)
+			}
+			if deleted[key] || configuredDomain(hosts, owner) {
+				continue
+			}
+			deleted[key] = true
+
+			unlock := a.lockDomain(domain)
+			err := client.DeleteRecord(a.ctx, domain, record.RecordType)
+			unlock()
+			if err != nil {
+				a.logger.Error("failed to delete stale DNS record",
+					zap.String("domain", domain),
+					zap.String("record_type", record.RecordType),
+					zap.String("provider", name),
+					zap.Error(err))
+				continue
+			}
+
+			a.logger.Info("deleted stale DNS record",
+				zap.String("domain", domain),
+				zap.String("record_type", record.RecordType),
+				zap.String("value", record.Value),
+				zap.String("provider", name))
+			a.recordDeleted(name, domain, record.RecordType, record.Value)
+		}
+	}
+}
+
+// configuredHosts returns the hosts matched by the routes of the HTTP app
+// and the domains registered at startup
+func (a *App) configuredHosts() ([]string, error) {
+	var hosts []string
+	for _, item := range a.static {
+		hosts = append(hosts, item.domain)
+	}
+	hosts = append(hosts, a.aliases...)
+
+	httpApp, err := a.caddyCtx.AppIfConfigured("http")
+	if errors.Is(err, caddy.ErrNotConfigured) {
+		return hosts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range httpApp.(*caddyhttp.App).Servers {
+		hosts = appendRouteHosts(hosts, server.Routes)
+	}
+
+	// Handlers may register other names than the hosts they serve
+	configured := append([]string(nil), hosts...)
+	known := make(map[string]bool)
+	for _, host := range hosts {
+		known[host] = true
+	}
+	for _, h := range a.handlers {
+		for _, name := range h.configuredNames(hosts) {
+			if !known[name] {
+				known[name] = true
+				configured = append(configured, name)
+			}
+		}
+	}
+	return configured, nil
+}
+
+// configuredNames returns the names h registers for the configured hosts,
+// like ServeHTTP maps the host of a request. Overrides with per-request
+// placeholders can't be known up front and are left out.
+func (h *Handler) configuredNames(hosts []string) []string {
+	names := hosts
+	if h.DomainOverride != "" {
+		value := h.DomainOverride
+		if strings.Contains(value, "{") {
+			var err error
+			if value, err = caddy.NewReplacer().ReplaceOrErr(value, true, true); err != nil {
+				return nil
+			}
+		}
+		override, err := overrideDomain(value)
+		if err != nil {
+			return nil
+		}
+		names = []string{override}
+	}
+
+	if h.RewriteDomain != nil {
+		var rewritten []string
+		for _, name := range names {
+			// Wildcard hosts stand for their subdomains, rewrite the base
+			base, wildcard := strings.CutPrefix(name, "*.")
+			// Requests with invalid results are skipped as well
+			if base, err := h.RewriteDomain.apply(base); err == nil {
+				if wildcard {
+					base = "*." + base
+				}
+				rewritten = append(rewritten, base)
+			}
+		}
+		names = rewritten
+	}
+
+	if h.RegisteredDomain {
+		var registered []string
+		for _, name := range names {
+			// All subdomains of a wildcard share its registered domain
+			if name, err := h.registeredDomain(strings.TrimPrefix(name, "*.")); err == nil {
+				registered = append(registered, name)
+			}
+		}
+		names = registered
+	}
+	return names
+}
+
+// appendRouteHosts appends the hosts of the host matchers in routes,
+// including subroutes
+func appendRouteHosts(hosts []string, routes caddyhttp.RouteList) []string {
+	for _, route := range routes {
+		for _, set := range route.MatcherSets {
+			for _, matcher := range set {
+				if match, ok := matcher.(*caddyhttp.MatchHost); ok {
+					hosts = append(hosts, *match...)
+				}
+			}
+		}
+		for _, handler := range route.Handlers {
+			if subroute, ok := handler.(*caddyhttp.Subroute); ok {
+				hosts = appendRouteHosts(hosts, subroute.Routes)
+			}
+		}
+	}
+	return hosts
+}
+
+// configuredDomain reports whether a record for domain belongs to one of
+// hosts. Wildcard records cover their subdomains and SRV records live below
+// the host they point at.
+func configuredDomain(hosts []string, domain string) bool {
+	for _, host := range hosts {
+		host = normalizeDomain(host)
+		if _, ok := matchDomain([]string{host}, domain); ok {
+			return true
+		}
+		if provider.IsWildcard(domain) && wildcardDomain(host) == domain {
+			return true
+		}
+		if strings.HasSuffix(domain, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue schedules domain for reconciliation by h unless it is already pending.
+// It never blocks, domains are dropped when the queue is full.
+func (a *App) enqueue(h *Handler, domain, ip string) {
+	item := queuedDomain{handler: h, domain: domain, ip: ip}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stopped || a.pending[item] {
+		return
+	}
+
+	select {
+	case a.queue <- item:
+		a.pending[item] = true
+	default:
+		a.logger.Warn("domain queue full, skipping domain", zap.String("domain", domain))
+	}
+}
+
+// worker reconciles queued domains until the queue is closed. Several
+// workers may run, concurrent calls for one domain are serialized by
+// lockDomain.
+func (a *App) worker() {
+	for item := range a.queue {
+		// Draining took too long, drop the remaining domains
+		if a.ctx.Err() != nil {
+			continue
+		}
+
+		batch := []queuedDomain{item}
+		if a.BatchWindow > 0 {
+			batch = a.collectBatch(batch, time.Duration(a.BatchWindow))
+		}
+
+		if a.BatchWindow > 0 {
+			for _, batcher := range a.batchers {
+				batcher.BeginBatch()
+			}
+		}
+		for _, item := range batch {
+			if _, err := item.handler.handleDomain(a.ctx, item.domain, item.ip); err != nil {
+				fields := []zap.Field{zap.String("domain", item.domain), zap.Error(err)}
+				if errors.Is(err, provider.ErrUnauthorized) {
+					fields = append(fields, zap.String("hint", "check the credentials and permissions of the provider"))
+				}
+				item.handler.logger.Error("failed to handle domain", fields...)
+			}
+		}
+		if a.BatchWindow > 0 {
+			for name, batcher := range a.batchers {
+				if err := batcher.EndBatch(); err != nil {
+					a.logger.Error("failed to apply batched changes", zap.String("provider", name), zap.Error(err))
+				}
+			}
+		}
+
+		a.mu.Lock()
+		for _, item := range batch {
+			delete(a.pending, item)
+			a.remember(item)
+		}
+		a.mu.Unlock()
+	}
+}
+
+// remember adds item to the domains reconciled periodically, replacing the
+// IPs of earlier requests. Hosts of requests are attacker-chosen, so only
+// configured or allowed domains are added, up to maxSeenDomains. a.mu must
+// be held.
+func (a *App) remember(item queuedDomain) {
+	key := queuedDomain{handler: item.handler, domain: item.domain}
+	if _, exists := a.seen[key]; exists {
+		a.seen[key] = item
+		return
+	}
+
+	domain := normalizeDomain(item.domain)
+	if !configuredDomain(a.hosts, domain) && len(item.handler.AllowedPattern) == 0 {
+		if a.Debug {
+			a.logger.Debug("domain not configured, not reconciling it periodically", zap.String("domain", domain))
+		}
+		return
+	}
+	if len(a.seen) >= maxSeenDomains {
+		a.logger.Warn("too many known domains, not reconciling domain periodically",
+			zap.String("domain", domain),
+			zap.Int("max", maxSeenDomains))
+		return
+	}
+	a.seen[key] = item
+}
+
+// collectBatch adds domains arriving within window to batch. It returns
+// early when the queue is closed.
+func (a *App) collectBatch(batch []queuedDomain, window time.Duration) []queuedDomain {
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+
+	for {
+		select {
+		case item, ok := <-a.queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, item)
+		case <-timer.C:
+			if a.Debug {
+				a.logger.Debug("processing batch", zap.Int("domains", len(batch)))
+			}
+			return batch
+		}
+	}
+}
+
+// reconcileLoop re-queues every domain seen so far on each tick until stopped
+func (a *App) reconcileLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.reconcileStop:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			items := make([]queuedDomain, 0, len(a.seen))
+			for _, item := range a.seen {
+				items = append(items, item)
+			}
+			a.mu.Unlock()
+
+			if a.Debug {
+				a.logger.Debug("reconciling known domains", zap.Int("count", len(items)))
+			}
+			for _, item := range items {
+				a.enqueue(item.handler, item.domain, item.ip)
+			}
+		}
+	}
+}
+
+// withRetry wraps client with the configured retry policy
+func (a *App) withRetry(client provider.DNSService) provider.DNSService {
+	baseDelay := time.Duration(a.RetryDelay)
+	if baseDelay <= 0 {
+		baseDelay = defaultRetryDelay
+	}
+	maxDelay := time.Duration(a.RetryMaxDelay)
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	return provider.NewRetryService(client, a.RetryAttempts, baseDelay, maxDelay, a.logger)
+}
+
+// cacheTTL returns the effective lookup cache TTL, zero when disabled
+func (a *App) cacheTTL() time.Duration {
+	switch {
+	case a.CacheTTL < 0:
+		return 0
+	case a.CacheTTL == 0:
+		return defaultCacheTTL
+	default:
+		return time.Duration(a.CacheTTL)
+	}
+}
+
+// lockDomain blocks until no one else reconciles domain and returns the
+// function releasing the lock. Without it, concurrent callers could all find
+// no record and each create one.
+func (a *App) lockDomain(domain string) func() {
+	a.mu.Lock()
+	lock, exists := a.domainLocks[domain]
+	if !exists {
+		lock = new(domainLock)
+		a.domainLocks[domain] = lock
+	}
+	lock.refs++
+	a.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(a.domainLocks, domain)
+		}
+	}
+}
+
+// recordChanged updates metrics, ownership and the webhook after a record
+// was created or updated through the named provider. id is the record's ID
+// if the provider returned one, previous holds the values an update
+// replaced. Dry runs change nothing.
+func (a *App) recordChanged(action, providerName, domain, recordType, value, id string, previous []string) {
+	if a.DryRun {
+		return
+	}
+
+	switch action {
+	case "create":
+		a.metrics.recordCreated(providerName, recordType)
+	case "update":
+		a.metrics.recordUpdated(providerName, recordType)
+	}
+	a.trackRecord(providerName, domain, recordType, value, id)
+	a.notify(recordEvent{Domain: domain, IP: value, RecordType: recordType, Provider: providerName, Action: action, ID: id, Previous: previous})
+}
+
+// recordDeleted updates ownership and the webhook after a record was deleted
+// through the named provider. Dry runs change nothing.
+func (a *App) recordDeleted(providerName, domain, recordType, value string) {
+	if a.DryRun {
+		return
+	}
+
+	a.mu.Lock()
+	delete(a.managed, managedKey{Provider: providerName, Domain: domain, RecordType: recordType})
+	a.mu.Unlock()
+	a.saveState()
+
+	a.notify(recordEvent{Domain: domain, IP: value, RecordType: recordType, Provider: providerName, Action: "delete"})
+}
+
+// trackRecord remembers a record created or updated through the named provider
+func (a *App) trackRecord(providerName, domain, recordType, value, id string) {
+	a.mu.Lock()
+	key := managedKey{Provider: providerName, Domain: domain, RecordType: recordType}
+	lastSeen := time.Now()
+	if record, exists := a.managed[key]; exists {
+		lastSeen = record.LastSeen
+	}
+	a.managed[key] = &managedRecord{Value: value, ID: id, LastSync: time.Now(), LastSeen: lastSeen}
+	a.mu.Unlock()
+
+	a.saveState()
+}
+
+// allowNewDomain reports whether records may be created for domain, i.e.
+// max_records isn't set, domain is already managed or the limit isn't reached
+func (a *App) allowNewDomain(domain string) bool {
+	if a.MaxRecords <= 0 {
+		return true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	domains := make(map[string]bool)
+	for key := range a.managed {
+		if key.Domain == domain {
+			return true
+		}
+		domains[key.Domain] = true
+	}
+	return len(domains) < a.MaxRecords
+}
+
+// providerDown reports whether the provider is in its failover cooldown
+func (a *App) providerDown(name string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	health, ok := a.health[name]
+	return ok && time.Now().Before(health.downUntil)
+}
+
+// providerResult records the outcome of a failover attempt. The provider
+// is marked down after failover_threshold consecutive failures.
+func (a *App) providerResult(name string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	health, ok := a.health[name]
+	if !ok {
+		health = new(providerHealth)
+		a.health[name] = health
+	}
+
+	if err == nil {
+		if health.failures >= a.failoverThreshold() {
+			a.logger.Info("provider recovered", zap.String("provider", name))
+		}
+		health.failures = 0
+		health.downUntil = time.Time{}
+		return
+	}
+
+	health.failures++
+	if health.failures >= a.failoverThreshold() {
+		cooldown := time.Duration(a.FailoverCooldown)
+		if cooldown <= 0 {
+			cooldown = defaultFailoverCooldown
+		}
+		health.downUntil = time.Now().Add(cooldown)
+		a.logger.Warn("provider marked unhealthy, failing over",
+			zap.String("provider", name),
+			zap.Int("failures", health.failures),
+			zap.Duration("cooldown", cooldown),
+			zap.Error(err))
+	}
+}
+
+// failoverThreshold returns failover_threshold or its default
+func (a *App) failoverThreshold() int {
+	if a.FailoverThreshold > 0 {
+		return a.FailoverThreshold
+	}
+	return defaultFailoverThreshold
+}
+
+// touchRecord refreshes the sync time of a managed record found to be correct
+func (a *App) touchRecord(providerName, domain, recordType string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := managedKey{Provider: providerName, Domain: domain, RecordType: recordType}
+	if record, exists := a.managed[key]; exists {
+		record.LastSync = time.Now()
+	}
+}
+
+// ManagedRecordInfo describes a record owned by this module
+type ManagedRecordInfo struct {
+	Domain     string    `json:"domain"`
+	RecordType string    `json:"record_type"`
+	Value      string    `json:"value"`
+	Provider   string    `json:"provider"`
+	ID         string    `json:"id,omitempty"`
+	LastSync   time.Time `json:"last_sync"`
+	LastSeen   time.Time `json:"last_seen"` // last request for the domain
+}
+
+// ManagedRecords returns the records created or updated by this module,
+// sorted by domain
+func (a *App) ManagedRecords() []ManagedRecordInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	records := make([]ManagedRecordInfo, 0, len(a.managed))
+	for key, record := range a.managed {
+		records = append(records, ManagedRecordInfo{
+			Domain:     key.Domain,
+			RecordType: key.RecordType,
+			Value:      record.Value,
+			Provider:   key.Provider,
+			ID:         record.ID,
+			LastSync:   record.LastSync,
+			LastSeen:   record.LastSeen,
+		})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Domain != records[j].Domain {
+			return records[i].Domain < records[j].Domain
+		}
+		if records[i].RecordType != records[j].RecordType {
+			return records[i].RecordType < records[j].RecordType
+		}
+		return records[i].Provider < records[j].Provider
+	})
+	return records
+}
+
+// ProviderHealth is the result of validating one provider
+type ProviderHealth struct {
+	Provider    string    `json:"provider"`
+	Healthy     bool      `json:"healthy"`
+	Error       string    `json:"error,omitempty"`
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// CheckProviders validates all providers concurrently, sorted by name
+func (a *App) CheckProviders(ctx context.Context) []ProviderHealth {
+	results := make([]ProviderHealth, 0, len(a.clients))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, client := range a.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := ProviderHealth{Provider: name, Healthy: true}
+			if err := client.Validate(ctx); err != nil {
+				result.Healthy = false
+				result.Error = err.Error()
+			}
+			result.LastChecked = time.Now()
+
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Provider < results[j].Provider
+	})
+	return results
+}
+
+func (a *App) createProvider(config *ProviderConfig) (provider.DNSService, error) {
+	tlsConfig, err := provider.TLSConfig(config.Insecure, config.SkipHostnameVerify, config.CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Type {
+	case "opnsense":
+		autoApply := config.AutoApply == nil || *config.AutoApply
+		pool := provider.ConnPool{
+			MaxIdleConns:      config.MaxIdleConns,
+			IdleConnTimeout:   time.Duration(config.IdleConnTimeout),
+			DisableKeepAlives: config.KeepAlive != nil && !*config.KeepAlive,
+		}
+		return provider.NewOPNsenseProvider(config.Hostname, config.APIKey, config.APISecret, config.AuthMode, config.DNSService, config.TTL, config.Comment, autoApply, time.Duration(config.ReconfigureDelay), time.Duration(config.Timeout), tlsConfig, pool, config.UserAgent, config.Headers, a.logger, a.DebugProviders)
+	case "pihole":
+		return provider.NewPiholeProvider(config.Hostname, config.APIKey, config.TTL, time.Duration(config.Timeout), tlsConfig, a.logger, a.DebugProviders)
+	case "technitium":
+		return provider.NewTechnitiumProvider(config.Hostname, config.APIKey, config.TTL, time.Duration(config.Timeout), tlsConfig, a.logger, a.DebugProviders)
+	case "adguard":
+		return provider.NewAdGuardProvider(config.Hostname, config.APIKey, config.APISecret, config.TTL, time.Duration(config.Timeout), tlsConfig, a.logger, a.DebugProviders)
+	case "powerdns":
+		return provider.NewPowerDNSProvider(config.Hostname, config.APIKey, config.Zone, config.TTL, time.Duration(config.Timeout), tlsConfig, a.logger, a.DebugProviders)
+	case "rfc2136":
+		return provider.NewRFC2136Provider(config.Hostname, config.Zone, config.TSIGKey, config.TSIGSecret, config.TSIGAlgorithm, config.TTL, time.Duration(config.Timeout), a.logger, a.DebugProviders)
+	case "nsupdate":
+		return provider.NewNsupdateProvider(config.Hostname, config.Zone, config.KeyFile, config.NsupdatePath, config.TTL, time.Duration(config.Timeout), a.logger, a.DebugProviders)
+	case "knot":
+		return provider.NewKnotProvider(config.Zone, config.KnotSocket, config.KnotcPath, config.TTL, time.Duration(config.Timeout), a.logger, a.DebugProviders)
+	case "cloudflare":
+		return provider.NewCloudflareProvider(config.APIKey, config.ZoneID, config.TTL, config.Proxied, time.Duration(config.Timeout), a.logger, a.DebugProviders)
+	case "nextdns":
+		return provider.NewNextDNSProvider(config.APIKey, config.ProfileID, time.Duration(config.Timeout), a.logger, a.DebugProviders)
+	case "dnsmasq":
+		return provider.NewDnsmasqProvider(config.Hostname, config.SSHUser, config.SSHKey, config.HostsFile, config.KnownHosts, time.Duration(config.Timeout), config.Insecure, a.logger, a.DebugProviders)
+	case "mikrotik":
+		return provider.NewMikrotikProvider(config.Hostname, config.APIKey, config.APISecret, config.TTL, time.Duration(config.Timeout), tlsConfig, a.logger, a.DebugProviders)
+	case "unifi":
+		return provider.NewUnifiProvider(config.Hostname, config.APIKey, config.APISecret, config.Site, config.TTL, time.Duration(config.Timeout), tlsConfig, a.logger, a.DebugProviders)
+	case "coredns-etcd":
+		return provider.NewCoreDNSEtcdProvider(config.Endpoints, config.Prefix, config.APIKey, config.APISecret, config.ClientCert, config.ClientKey, config.TTL, time.Duration(config.Timeout), tlsConfig, a.logger, a.DebugProviders)
+	case "hostsfile":
+		return provider.NewHostsFileProvider(config.HostsFile, a.logger, a.DebugProviders)
+	case "webhook":
+		return provider.NewWebhookProvider(config.Hostname, config.APIKey, config.TTL, time.Duration(config.Timeout), tlsConfig, config.UserAgent, config.Headers, a.logger, a.DebugProviders)
+	case "memory":
+		return provider.NewMemoryProvider(a.logger, a.DebugProviders), nil
+	default:
+		return nil, fmt.Errorf("unsupported provider type: %s", config.Type)
+	}
+}
+
+// expandPlaceholders replaces placeholders such as {env.OPNSENSE_SECRET} in
+// the connection settings
+func (c *ProviderConfig) expandPlaceholders(repl *caddy.Replacer) {
+	c.Hostname = repl.ReplaceKnown(c.Hostname, "")
+	c.APIKey = repl.ReplaceKnown(c.APIKey, "")
+	c.APISecret = repl.ReplaceKnown(c.APISecret, "")
+	c.TSIGSecret = repl.ReplaceKnown(c.TSIGSecret, "")
+	for i, endpoint := range c.Endpoints {
+		c.Endpoints[i] = repl.ReplaceKnown(endpoint, "")
+	}
+	for header, value := range c.Headers {
+		c.Headers[header] = repl.ReplaceKnown(value, "")
+	}
+}
+
+// acceptsDomain reports whether domain is within one of the zones of the
+// provider, or zones is empty
+func (c *ProviderConfig) acceptsDomain(domain string) bool {
+	if len(c.Zones) == 0 {
+		return true
+	}
+	for _, zone := range c.Zones {
+		if inZone(domain, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// inZone reports whether the normalized domain is zone or a subdomain of it
+func inZone(domain, zone string) bool {
+	zone = normalizeDomain(zone)
+	return domain == zone || strings.HasSuffix(domain, "."+zone)
+}
+
+// SplitHorizonRule registers IPs when the client address of the triggering
+// request is within Range
+type SplitHorizonRule struct {
+	Range string   `json:"range"` // CIDR notation
+	IPs   []string `json:"ips"`
+
+	network *net.IPNet
+}
+
+// OnlyOnConfig selects the requests that register their domain. Requests
+// must match Methods and Paths if set, and neither SkipMethods nor SkipPaths.
+// Paths use the syntax of Caddy's path matcher.
+type OnlyOnConfig struct {
+	Methods     caddyhttp.MatchMethod `json:"methods,omitempty"`
+	Paths       caddyhttp.MatchPath   `json:"paths,omitempty"`
+	SkipMethods caddyhttp.MatchMethod `json:"skip_methods,omitempty"`
+	SkipPaths   caddyhttp.MatchPath   `json:"skip_paths,omitempty"`
+}
+
+// DomainRewrite replaces the matches of Find in the lower-cased host with
+// Replace, which may refer to submatches like $1. Hosts that don't match are
+// kept.
+type DomainRewrite struct {
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+// SRVConfig describes the SRV record _<service>._<proto>.<domain>
+type SRVConfig struct {
+	Service  string `json:"service"`
+	Proto    string `json:"proto,omitempty"` // default "tcp"
+	Port     int    `json:"port"`
+	Priority int    `json:"priority,omitempty"`
+	Weight   int    `json:"weight,omitempty"`
+}
+
+// Handler methods
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.local_dns",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+func (h *Handler) Provision(ctx caddy.Context) error {
+	h.logger = ctx.Logger(h)
+
+	// Get the app instance, without creating an empty one
+	appIface, err := ctx.AppIfConfigured("local_dns")
+	if errors.Is(err, caddy.ErrNotConfigured) && !h.RequireApp {
+		h.logger.Warn("local_dns app not configured, the handler does nothing; add the local_dns global option")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("local_dns app not configured: %w", err)
+	}
+	h.app = appIface.(*App)
+
+	if len(h.Providers) == 0 {
+		if h.app.DefaultProvider == "" {
+			return errors.New("provider name is required, or set default_provider in the global configuration")
+		}
+		h.Providers = []string{h.app.DefaultProvider}
+	}
+
+	for _, name := range h.Providers {
+		if _, exists := h.app.clients[name]; !exists {
+			return fmt.Errorf("provider %s not found in global configuration", name)
+		}
+	}
+
+	// Templated values are validated once they're resolved
+	if !h.templatedIPs() {
+		if err := validateIPs(h.IPOverride); err != nil {
+			return fmt.Errorf("invalid ip_override: %w", err)
+		}
+	}
+
+	if h.CNAME != "" && len(h.IPOverride) > 0 {
+		return errors.New("cname and ip_override are mutually exclusive")
+	}
+
+	if h.CNAME != "" && h.IPFromHeader != "" {
+		return errors.New("cname and ip_from_header are mutually exclusive")
+	}
+
+	if h.CNAME != "" && len(h.SplitHorizon) > 0 {
+		return errors.New("cname and split_horizon are mutually exclusive")
+	}
+
+	for _, rule := range h.SplitHorizon {
+		_, network, err := net.ParseCIDR(rule.Range)
+		if err != nil {
+			return fmt.Errorf("invalid split_horizon range: %w", err)
+		}
+		if len(rule.IPs) == 0 {
+			return fmt.Errorf("split_horizon range %s has no IPs", rule.Range)
+		}
+		if err := validateIPs(rule.IPs); err != nil {
+			return fmt.Errorf("invalid split_horizon IPs for %s: %w", rule.Range, err)
+		}
+		rule.network = network
+	}
+
+	if h.CNAME != "" && h.TXT != "" {
+		return errors.New("cname and txt are mutually exclusive, a CNAME can't coexist with other records")
+	}
+
+	if h.CNAME != "" && h.CreatePTR {
+		return errors.New("create_ptr requires address records, it can't be combined with cname")
+	}
+
+	for _, pattern := range h.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %s: %w", pattern, err)
+		}
+	}
+
+	for _, pattern := range h.AllowedPattern {
+		if expr, ok := strings.CutPrefix(pattern, "~"); ok {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return fmt.Errorf("invalid allowed_pattern %s: %w", pattern, err)
+			}
+			h.allowedRegexps = append(h.allowedRegexps, re)
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid allowed_pattern %s: %w", pattern, err)
+		}
+	}
+
+	if h.RewriteDomain != nil {
+		re, err := regexp.Compile(h.RewriteDomain.Find)
+		if err != nil {
+			return fmt.Errorf("invalid rewrite_domain %s: %w", h.RewriteDomain.Find, err)
+		}
+		h.RewriteDomain.re = re
+	}
+
+	if h.OnlyOn != nil {
+		// Lower-cases the paths like the path matcher does
+		for _, paths := range []caddyhttp.MatchPath{h.OnlyOn.Paths, h.OnlyOn.SkipPaths} {
+			if err := paths.Provision(ctx); err != nil {
+				return fmt.Errorf("invalid only_on paths: %w", err)
+			}
+		}
+		for _, methods := range []caddyhttp.MatchMethod{h.OnlyOn.Methods, h.OnlyOn.SkipMethods} {
+			for i, method := range methods {
+				methods[i] = strings.ToUpper(method)
+			}
+		}
+	}
+
+	switch h.OnError {
+	case "", "continue", "fail":
+	default:
+		return fmt.Errorf("invalid on_error %s: must be continue or fail", h.OnError)
+	}
+
+	if h.SRV != nil {
+		if h.SRV.Service == "" {
+			return errors.New("srv requires a service")
+		}
+		if h.SRV.Proto == "" {
+			h.SRV.Proto = "tcp"
+		}
+		if h.SRV.Port < 1 || h.SRV.Port > 65535 {
+			return fmt.Errorf("invalid srv port %d", h.SRV.Port)
+		}
+		if h.SRV.Priority < 0 || h.SRV.Priority > 65535 || h.SRV.Weight < 0 || h.SRV.Weight > 65535 {
+			return errors.New("srv priority and weight must be between 0 and 65535")
+		}
+	}
+
+	switch h.Mode {
+	case "", "create", "delete":
+	default:
+		return fmt.Errorf("invalid mode %s: must be create or delete", h.Mode)
+	}
+
+	switch h.RecordType {
+	case "", "auto", "A", "AAAA":
+	default:
+		return fmt.Errorf("invalid record_type %s: must be A, AAAA or auto", h.RecordType)
+	}
+
+	if h.CNAME != "" && (h.RecordType == "A" || h.RecordType == "AAAA") {
+		return errors.New("cname and record_type are mutually exclusive")
+	}
+
+	if h.RegisteredDomain && h.Wildcard {
+		return errors.New("registered_domain and wildcard are mutually exclusive")
+	}
+	for i, suffix := range h.PrivateSuffixes {
+		suffix, err := asciiDomain(strings.Trim(suffix, "."))
+		if err != nil || !validHostname(suffix) {
+			return fmt.Errorf("invalid private_suffixes entry %s", h.PrivateSuffixes[i])
+		}
+		h.PrivateSuffixes[i] = normalizeDomain(suffix)
+	}
+	// The longest suffix wins
+	sort.Slice(h.PrivateSuffixes, func(i, j int) bool {
+		return len(h.PrivateSuffixes[i]) > len(h.PrivateSuffixes[j])
+	})
+
+	// Without placeholders, the override can be checked right away
+	if h.DomainOverride != "" && !strings.Contains(h.DomainOverride, "{") {
+		if _, err := overrideDomain(h.DomainOverride); err != nil {
+			return fmt.Errorf("invalid domain_override: %w", err)
+		}
+	}
+
+	// Internationalized names are managed in their punycode form
+	if h.CNAME != "" {
+		cname, err := asciiDomain(h.CNAME)
+		if err != nil {
+			return fmt.Errorf("invalid cname: %w", err)
+		}
+		h.CNAME = cname
+	}
+	for i, domain := range h.Domains {
+		if h.Domains[i], err = asciiDomain(domain); err != nil {
+			return err
+		}
+	}
+	for i, alias := range h.Alias {
+		if h.Alias[i], err = asciiDomain(alias); err != nil {
+			return fmt.Errorf("invalid alias: %w", err)
+		}
+	}
+
+	for _, domain := range h.Domains {
+		if !strings.Contains(domain, ".") {
+			return fmt.Errorf("invalid domain %s: must contain a dot", domain)
+		}
+		h.app.static = append(h.app.static, queuedDomain{handler: h, domain: domain})
+	}
+
+	for _, alias := range h.Alias {
+		if !validHostname(alias) {
+			return fmt.Errorf("invalid alias %s: must be a host name", alias)
+		}
+	}
+	h.app.aliases = append(h.app.aliases, h.Alias...)
+	h.app.handlers = append(h.app.handlers, h)
+
+	for _, prefix := range h.Prefixes {
+		if !validHostname(prefix) {
+			return fmt.Errorf("invalid prefix %s: must be one or more host name labels", prefix)
+		}
+	}
+
+	return nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	// Without the app there's nothing to register with
+	if h.app == nil {
+		return next.ServeHTTP(w, r)
+	}
+
+	// Requests like health check probes don't register anything
+	selected, err := h.onlyOn(r)
+	if err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, err)
+	}
+	if !selected {
+		h.setDebugHeaders(w, "", "", actionSkipped)
+		return next.ServeHTTP(w, r)
+	}
+
+	// Plaintext requests (e.g. HTTP->HTTPS redirects) don't prove a working certificate
+	if h.RequireTLS && r.TLS == nil {
+		h.setDebugHeaders(w, "", "", actionSkipped)
+		return next.ServeHTTP(w, r)
+	}
+
+	// Get the domain from the request
+	domain := r.Host
+	if h.PreferSNI && r.TLS != nil && r.TLS.ServerName != "" {
+		domain = r.TLS.ServerName
+	}
+	if h.UseForwardedHost {
+		// The header may list several hosts, the first is the original one
+		if forwarded, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ","); strings.TrimSpace(forwarded) != "" {
+			domain = strings.TrimSpace(forwarded)
+		}
+	}
+
+	domain = stripPort(domain)
+
+	if h.DomainOverride != "" {
+		repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+		override, err := overrideDomain(repl.ReplaceAll(h.DomainOverride, ""))
+		if err != nil {
+			h.logger.Warn("invalid domain_override, skipping", zap.String("host", domain), zap.Error(err))
+			h.setDebugHeaders(w, "", "", actionSkipped)
+			return next.ServeHTTP(w, r)
+		}
+		domain = override
+	}
+
+	if h.RewriteDomain != nil {
+		rewritten, err := h.RewriteDomain.apply(domain)
+		if err != nil {
+			h.logger.Warn("invalid rewrite_domain result, skipping", zap.String("host", domain), zap.Error(err))
+			h.setDebugHeaders(w, "", "", actionSkipped)
+			return next.ServeHTTP(w, r)
+		}
+		domain = rewritten
+	}
+
+	if h.RegisteredDomain {
+		registered, err := h.registeredDomain(domain)
+		if err != nil {
+			h.logger.Warn("no registered domain, skipping", zap.String("host", domain), zap.Error(err))
+			h.setDebugHeaders(w, "", "", actionSkipped)
+			return next.ServeHTTP(w, r)
+		}
+		domain = registered
+	}
+
+	if h.Wildcard {
+		domain = wildcardDomain(domain)
+	}
+
+	// allowed_pattern and exclude match the punycode form
+	if ascii, err := asciiDomain(domain); err == nil {
+		domain = ascii
+	}
+
+	// Don't even queue hosts outside of the allowlist
+	if !h.allowed(normalizeDomain(domain)) {
+		if h.app.Debug {
+			h.logger.Debug("domain not allowed, skipping", zap.String("domain", domain))
+		}
+		h.setDebugHeaders(w, domain, "", actionSkipped)
+		return next.ServeHTTP(w, r)
+	}
+
+	// Requests keep the records from expiring with record_idle_timeout
+	if h.app.RecordIdleTimeout > 0 {
+		h.app.domainsRequested(h.requestNames(domain))
+	}
+
+	ip := h.headerIP(r, domain)
+	if ip == "" {
+		ip = h.splitHorizonIPs(r)
+	}
+	if ip == "" && h.templatedIPs() {
+		repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+		ips, err := h.resolveIPOverride(repl)
+		if err != nil {
+			h.logger.Warn("invalid ip_override, skipping", zap.String("domain", domain), zap.Error(err))
+			h.setDebugHeaders(w, domain, "", actionSkipped)
+			return next.ServeHTTP(w, r)
+		}
+		ip = strings.Join(ips, ",")
+	}
+
+	if h.OnError == "fail" {
+		// DNS registration is essential, don't serve the request without it
+		action, err := h.handleDomain(r.Context(), domain, ip)
+		if err != nil {
+			return caddyhttp.Error(http.StatusBadGateway, fmt.Errorf("failed to handle domain %s: %w", domain, err))
+		}
+		h.setDebugHeaders(w, domain, ip, action)
+		return next.ServeHTTP(w, r)
+	}
+
+	// Reconcile the DNS record in the background, errors are only logged
+	h.app.enqueue(h, domain, ip)
+
+	if h.DebugHeaders {
+		action := actionQueued
+		if _, excluded := h.excluded(normalizeDomain(domain)); excluded {
+			action = actionSkipped
+		}
+		h.setDebugHeaders(w, domain, ip, action)
+	}
+
+	return next.ServeHTTP(w, r)
+}
+
+// setDebugHeaders reports domain, its addresses and the action taken in
+// response headers if debug_headers is enabled
+func (h *Handler) setDebugHeaders(w http.ResponseWriter, domain, requestIPs, action string) {
+	if !h.DebugHeaders {
+		return
+	}
+
+	header := w.Header()
+	if domain != "" {
+		domain = normalizeDomain(domain)
+		header.Set("X-Local-DNS-Domain", domain)
+		if desired, err := h.desiredRecords(domain, requestIPs); err == nil {
+			var values []string
+			for _, record := range desired {
+				if record.RecordType != "TXT" {
+					values = append(values, record.Value)
+				}
+			}
+			header.Set("X-Local-DNS-IP", strings.Join(values, ","))
+		}
+	}
+	header.Set("X-Local-DNS-Action", action)
+}
+
+// splitHorizonIPs returns the comma-separated IPs of the first split_horizon
+// rule matching the client address of r, or an empty string if none matches
+func (h *Handler) splitHorizonIPs(r *http.Request) string {
+	if len(h.SplitHorizon) == 0 {
+		return ""
+	}
+
+	// Caddy's client IP honors trusted_proxies
+	client, _ := caddyhttp.GetVar(r.Context(), caddyhttp.ClientIPVarKey).(string)
+	if client == "" {
+		client, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	ip := net.ParseIP(client)
+	if ip == nil {
+		return ""
+	}
+
+	for _, rule := range h.SplitHorizon {
+		if rule.network.Contains(ip) {
+			return strings.Join(rule.IPs, ",")
+		}
+	}
+	return ""
+}
+
+// headerIP returns the IP from the ip_from_header header of r, or an empty
+// string if it isn't configured, missing or invalid
+func (h *Handler) headerIP(r *http.Request, domain string) string {
+	if h.IPFromHeader == "" {
+		return ""
+	}
+
+	value := strings.TrimSpace(r.Header.Get(h.IPFromHeader))
+	if value == "" {
+		h.logger.Warn("IP header missing, using configured IP",
+			zap.String("domain", domain),
+			zap.String("header", h.IPFromHeader))
+		return ""
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		h.logger.Warn("invalid IP in header, using configured IP",
+			zap.String("domain", domain),
+			zap.String("header", h.IPFromHeader),
+			zap.String("value", value))
+		return ""
+	}
+	return ip.String()
+}
+
+// handleDomain reconciles the records of domain and the aliases and returns
+// the most significant action taken. ip, a comma-separated list, replaces the
+// configured IPs when not empty.
+func (h *Handler) handleDomain(ctx context.Context, domain, ip string) (string, error) {
+	// Providers expect punycode, so records and comparisons use it throughout
+	domain, err := asciiDomain(domain)
+	if err != nil {
+		return actionSkipped, err
+	}
+
+	action, err := h.reconcileDomain(ctx, domain, ip)
+	prefixed := h.prefixedNames(domain)
+	if len(h.Alias) == 0 && len(prefixed) == 0 {
+		return action, err
+	}
+
+	// Aliases and prefixed names are handled even if the domain failed
+	errs := []error{err}
+	for _, alias := range h.Alias {
+		aliasAction, err := h.reconcileDomain(ctx, alias, ip)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("alias %s: %w", alias, err))
+			continue
+		}
+		action = mergeAction(action, aliasAction)
+	}
+	for _, name := range prefixed {
+		nameAction, err := h.reconcileDomain(ctx, name, ip)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("prefixed name %s: %w", name, err))
+			continue
+		}
+		action = mergeAction(action, nameAction)
+	}
+	return action, errors.Join(errs...)
+}
+
+// prefixedNames returns <prefix>.<domain> for each of prefixes. Names that
+// aren't valid host names, e.g. below a wildcard, and duplicates of the
+// domain, an alias or each other are left out.
+func (h *Handler) prefixedNames(domain string) []string {
+	if len(h.Prefixes) == 0 {
+		return nil
+	}
+
+	domain = normalizeDomain(domain)
+	seen := map[string]bool{domain: true}
+	for _, alias := range h.Alias {
+		seen[normalizeDomain(alias)] = true
+	}
+
+	var names []string
+	for _, prefix := range h.Prefixes {
+		name := normalizeDomain(prefix + "." + domain)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if !validHostname(name) {
+			if h.app.Debug {
+				h.logger.Debug("invalid prefixed name, skipping", zap.String("domain", domain), zap.String("name", name))
+			}
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// reconcileDomain reconciles the records of a single domain and returns the
+// most significant action taken
+func (h *Handler) reconcileDomain(ctx context.Context, domain, ip string) (string, error) {
+	domain = normalizeDomain(domain)
+
+	if reason, ignored := h.app.ignored(domain); ignored {
+		if h.app.Debug {
+			h.logger.Debug("host ignored, skipping", zap.String("domain", domain), zap.String("reason", reason))
+		}
+		return actionSkipped, nil
+	}
+
+	if pattern, excluded := h.excluded(domain); excluded {
+		if h.app.Debug {
+			h.logger.Debug("domain excluded, skipping", zap.String("domain", domain), zap.String("pattern", pattern))
+		}
+		return actionSkipped, nil
+	}
+
+	if !h.allowed(domain) {
+		if h.app.Debug {
+			h.logger.Debug("domain not allowed, skipping", zap.String("domain", domain))
+		}
+		return actionSkipped, nil
+	}
+
+	// Requests with on_error fail reconcile concurrently with the worker
+	unlock := h.app.lockDomain(domain)
+	defer unlock()
+
+	if h.Tag != "" {
+		ctx = provider.WithTag(ctx, h.tag(domain))
+	}
+
+	desired, err := h.desiredRecords(domain, ip)
+	if err != nil {
+		return "", err
+	}
+
+	// Most requests change nothing, only log details when debugging
+	if h.app.Debug {
+		h.logger.Debug("handling domain",
+			zap.String("domain", domain),
+			zap.Any("records", desired),
+			zap.Strings("providers", h.Providers))
+	}
+
+	providers := h.domainProviders(domain)
+	if h.Failover {
+		return h.failover(ctx, providers, domain, desired)
+	}
+
+	// A failing provider must not keep the others from being updated
+	action := actionNoop
+	var errs []error
+	for _, name := range providers {
+		providerAction, err := h.syncAll(ctx, name, domain, desired)
+		action = mergeAction(action, providerAction)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return action, errors.Join(errs...)
+}
+
+// domainProviders returns the providers of h whose zones include domain
+func (h *Handler) domainProviders(domain string) []string {
+	var providers []string
+	for _, name := range h.Providers {
+		if config := h.app.Providers[name]; !config.acceptsDomain(domain) {
+			if h.app.Debug {
+				h.logger.Debug("domain outside of provider zones, skipping provider",
+					zap.String("domain", domain),
+					zap.String("provider", name),
+					zap.Strings("zones", config.Zones))
+			}
+			continue
+		}
+		providers = append(providers, name)
+	}
+	return providers
+}
+
+// failover syncs the records with the first of providers that succeeds
+func (h *Handler) failover(ctx context.Context, providers []string, domain string, desired []desiredRecord) (string, error) {
+	var errs []error
+	for _, name := range h.failoverOrder(providers, domain) {
+		action, err := h.syncAll(ctx, name, domain, desired)
+		if ctx.Err() != nil {
+			return action, err
+		}
+		h.app.providerResult(name, err)
+		if err == nil {
+			return action, nil
+		}
+		errs = append(errs, err)
+		h.logger.Warn("provider failed, trying next one",
+			zap.String("domain", domain),
+			zap.String("provider", name),
+			zap.Error(err))
+	}
+	return actionNoop, errors.Join(errs...)
+}
+
+// failoverOrder returns the providers to try for domain with failover.
+// Providers in their cooldown are only tried when all of them are.
+func (h *Handler) failoverOrder(providers []string, domain string) []string {
+	var healthy []string
+	for _, name := range providers {
+		if !h.app.providerDown(name) {
+			healthy = append(healthy, name)
+		} else if h.app.Debug {
+			h.logger.Debug("provider unhealthy, skipping", zap.String("domain", domain), zap.String("provider", name))
+		}
+	}
+	if len(healthy) == 0 {
+		return providers
+	}
+	return healthy
+}
+
+// syncAll reconciles the records of domain, its SRV and PTR records
+// included, with the named provider
+func (h *Handler) syncAll(ctx context.Context, name, domain string, desired []desiredRecord) (string, error) {
+	action, err := h.syncProvider(ctx, name, domain, desired)
+	if err != nil {
+		return actionNoop, fmt.Errorf("provider %s: %w", name, err)
+	}
+
+	var errs []error
+	if srvName, srv, ok := h.srvRecord(domain); ok {
+		srvAction, err := h.syncProvider(ctx, name, srvName, []desiredRecord{srv})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("provider %s: SRV record: %w", name, err))
+		}
+		action = mergeAction(action, srvAction)
+	}
+
+	if h.CreatePTR && !provider.IsWildcard(domain) {
+		for _, record := range desired {
+			if record.RecordType != "A" && record.RecordType != "AAAA" {
+				continue
+			}
+			ptrAction, err := h.syncPTR(ctx, name, domain, record.Value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("provider %s: PTR record: %w", name, err))
+				continue
+			}
+			action = mergeAction(action, ptrAction)
+		}
+	}
+	return action, errors.Join(errs...)
+}
+
+// syncPTR reconciles the PTR record of ip pointing at domain. Providers
+// outside of the reverse zone or without PTR support are skipped.
+func (h *Handler) syncPTR(ctx context.Context, providerName, domain, ip string) (string, error) {
+	name, ok := h.reverseName(providerName, ip)
+	if !ok {
+		if h.app.Debug {
+			h.logger.Debug("reverse name outside of provider zones, skipping PTR record",
+				zap.String("domain", domain),
+				zap.String("reverse_name", name),
+				zap.String("provider", providerName))
+		}
+		return actionNoop, nil
+	}
+
+	action, err := h.syncProvider(ctx, providerName, name, []desiredRecord{{RecordType: "PTR", Value: domain}})
+	var unsupported provider.ErrUnsupportedRecordType
+	if errors.As(err, &unsupported) {
+		if h.app.Debug {
+			h.logger.Debug("PTR records not supported by provider, skipping",
+				zap.String("domain", domain),
+				zap.String("provider", providerName))
+		}
+		return actionNoop, nil
+	}
+	return action, err
+}
+
+// reverseName returns the reverse name of ip and whether it is within the
+// zones of the provider
+func (h *Handler) reverseName(providerName, ip string) (string, bool) {
+	name := provider.ReverseName(ip)
+	config := h.app.Providers[providerName]
+	return name, name != "" && config.acceptsDomain(name) && (config.Zone == "" || inZone(name, config.Zone))
+}
+
+// Actions reported by handleDomain, from least to most significant
+const (
+	actionSkipped = "skipped"
+	actionQueued  = "queued"
+	actionNoop    = "noop"
+	actionDeleted = "deleted"
+	actionUpdated = "updated"
+	actionCreated = "created"
+)
+
+// mergeAction returns the more significant of two actions
+func mergeAction(a, b string) string {
+	for _, action := range []string{actionCreated, actionUpdated, actionDeleted, actionNoop} {
+		if a == action || b == action {
+			return action
+		}
+	}
+	return a
+}
+
+// syncProvider reconciles the desired records of domain with the named
+// provider and returns the most significant action taken
+func (h *Handler) syncProvider(ctx context.Context, providerName, domain string, desired []desiredRecord) (string, error) {
+	client, exists := h.app.clients[providerName]
+	if !exists {
+		return "", fmt.Errorf("provider %s not found", providerName)
+	}
+
+	// Fetch all existing records so each record type can be reconciled
+	existing, err := client.FindRecord(ctx, domain)
+	if err != nil {
+		return "", fmt.Errorf("failed to find existing records: %w", err)
+	}
+
+	if h.Mode == "delete" {
+		return h.removeRecords(ctx, providerName, client, domain, desired, existing)
+	}
+
+	if h.RespectWildcards && len(existing) == 0 {
+		wildcard, covered, err := h.coveredByWildcard(ctx, client, domain, desired)
+		if err != nil {
+			return "", err
+		}
+		if covered {
+			if h.app.Debug {
+				h.logger.Debug("domain covered by wildcard record, skipping",
+					zap.String("domain", domain),
+					zap.String("wildcard", wildcard),
+					zap.String("provider", providerName))
+			}
+			return actionNoop, nil
+		}
+	}
+
+	// A CNAME can't coexist with other data, never replace one kind with the other
+	wantCNAME := desired[0].RecordType == "CNAME"
+	for _, record := range existing {
+		if wantCNAME != (record.RecordType == "CNAME") {
+			return "", fmt.Errorf("refusing to create %s record for %s: conflicting %s record exists",
+				desired[0].RecordType, domain, record.RecordType)
+		}
+	}
+
+	// Several addresses of one family are kept as a set of records
+	var types []string
+	values := make(map[string][]string)
+	for _, record := range desired {
+		if _, ok := values[record.RecordType]; !ok {
+			types = append(types, record.RecordType)
+		}
+		if !containsRecordValue(record.RecordType, values[record.RecordType], record.Value) {
+			values[record.RecordType] = append(values[record.RecordType], record.Value)
+		}
+	}
+
+	action := actionNoop
+	for _, recordType := range types {
+		// A set shrinking to one value still needs its other records removed
+		count := 0
+		for _, record := range existing {
+			if record.RecordType == recordType {
+				count++
+			}
+		}
+
+		var recordAction string
+		var err error
+		if len(values[recordType]) > 1 || count > 1 {
+			recordAction, err = h.reconcileRecordSet(ctx, providerName, client, domain, recordType, values[recordType], existing)
+		} else {
+			recordAction, err = h.reconcileRecord(ctx, providerName, client, domain, recordType, values[recordType][0], existing)
+		}
+		if err != nil {
+			return "", err
+		}
+		action = mergeAction(action, recordAction)
+	}
+	return action, nil
+}
+
+// coveredByWildcard reports whether the wildcard record of the parent of
+// domain, which is returned as well, has all desired records
+func (h *Handler) coveredByWildcard(ctx context.Context, client provider.DNSService, domain string, desired []desiredRecord) (string, bool, error) {
+	wildcard := wildcardDomain(domain)
+	if provider.IsWildcard(domain) || wildcard == domain {
+		return "", false, nil
+	}
+
+	existing, err := client.FindRecord(ctx, wildcard)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to find wildcard records: %w", err)
+	}
+
+	for _, record := range desired {
+		found := false
+		for _, candidate := range existing {
+			if candidate.RecordType == record.RecordType && candidate.Enabled && sameRecordValue(record.RecordType, candidate.Value, record.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return wildcard, false, nil
+		}
+	}
+	return wildcard, true, nil
+}
+
+// onlyOn reports whether r is selected by only_on, or it is unset
+func (h *Handler) onlyOn(r *http.Request) (bool, error) {
+	if h.OnlyOn == nil {
+		return true, nil
+	}
+	if slices.Contains(h.OnlyOn.SkipMethods, r.Method) {
+		return false, nil
+	}
+	if len(h.OnlyOn.Methods) > 0 && !slices.Contains(h.OnlyOn.Methods, r.Method) {
+		return false, nil
+	}
+	if len(h.OnlyOn.SkipPaths) > 0 {
+		skip, err := h.OnlyOn.SkipPaths.MatchWithError(r)
+		if err != nil || skip {
+			return false, err
+		}
+	}
+	if len(h.OnlyOn.Paths) > 0 {
+		return h.OnlyOn.Paths.MatchWithError(r)
+	}
+	return true, nil
+}
+
+// allowed reports whether domain matches allowed_pattern, or it is empty
+func (h *Handler) allowed(domain string) bool {
+	if len(h.AllowedPattern) == 0 {
+		return true
+	}
+	for _, re := range h.allowedRegexps {
+		if re.MatchString(domain) {
+			return true
+		}
+	}
+
+	var globs []string
+	for _, pattern := range h.AllowedPattern {
+		if !strings.HasPrefix(pattern, "~") {
+			globs = append(globs, pattern)
+		}
+	}
+	_, ok := matchDomain(globs, domain)
+	return ok
+}
+
+// excluded reports whether domain matches one of the exclude patterns
+// and returns the matching pattern
+func (h *Handler) excluded(domain string) (string, bool) {
+	return matchDomain(h.Exclude, domain)
+}
+
+// ignored reports whether domain is an IP address or matches ignore_hosts
+// and returns the reason
+func (a *App) ignored(domain string) (string, bool) {
+	if net.ParseIP(strings.Trim(domain, "[]")) != nil {
+		return "IP address", true
+	}
+
+	patterns := a.IgnoreHosts
+	if patterns == nil {
+		patterns = defaultIgnoreHosts
+	}
+	if pattern, ok := matchDomain(patterns, domain); ok {
+		return "matches " + pattern, true
+	}
+	return "", false
+}
+
+// matchDomain returns the first pattern matching domain. A leading "*."
+// matches all subdomains, other patterns use glob syntax.
+func matchDomain(patterns []string, domain string) (string, bool) {
+	for _, pattern := range patterns {
+		p := normalizeDomain(pattern)
+		if suffix, ok := strings.CutPrefix(p, "*"); ok && strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(domain, suffix) {
+				return pattern, true
+			}
+			continue
+		}
+		if matched, _ := path.Match(p, domain); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// desiredRecord is a record the handler wants to exist for each domain
+type desiredRecord struct {
+	RecordType string `json:"type"`
+	Value      string `json:"value"`
+}
+
+// desiredRecords returns the CNAME if configured, otherwise one address
+// record per IP chosen by the request (its header or split_horizon),
+// ip_override or, as a fallback, the global caddy_ip of the family chosen by
+// record_type, followed by the TXT record if configured
+func (h *Handler) desiredRecords(domain, requestIPs string) ([]desiredRecord, error) {
+	if h.CNAME != "" {
+		return []desiredRecord{{RecordType: "CNAME", Value: h.CNAME}}, nil
+	}
+
+	ips := h.IPOverride
+	if requestIPs != "" {
+		ips = strings.Split(requestIPs, ",")
+	} else if h.templatedIPs() {
+		// Without a request only global placeholders like {env.*} resolve
+		resolved, err := h.resolveIPOverride(caddy.NewReplacer())
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip_override: %w", err)
+		}
+		ips = resolved
+	}
+	if len(ips) == 0 {
+		ips = h.app.CaddyIP
+	}
+
+	if len(ips) == 0 {
+		return nil, errors.New("no IP address configured: set either ip_override in handler or caddy_ip in global config")
+	}
+
+	if h.RecordType == "A" || h.RecordType == "AAAA" {
+		var matching []string
+		for _, ip := range ips {
+			if provider.RecordTypeForIP(ip) == h.RecordType {
+				matching = append(matching, ip)
+			}
+		}
+		if len(matching) == 0 {
+			return nil, fmt.Errorf("no IP address for record_type %s configured", h.RecordType)
+		}
+		ips = matching
+	}
+
+	records := make([]desiredRecord, 0, len(ips)+1)
+	for _, ip := range ips {
+		records = append(records, desiredRecord{RecordType: provider.RecordTypeForIP(ip), Value: ip})
+	}
+	if h.TXT != "" {
+		txt := strings.NewReplacer("{domain}", domain, "{ip}", strings.Join(ips, ",")).Replace(h.TXT)
+		records = append(records, desiredRecord{RecordType: "TXT", Value: txt})
+	}
+	return records, nil
+}
+
+// removeRecords deletes the existing records of domain with the types of
+// the desired records
+func (h *Handler) removeRecords(ctx context.Context, providerName string, client provider.DNSService, domain string, desired []desiredRecord, existing []*provider.DNSRecord) (string, error) {
+	action := actionNoop
+	deleted := make(map[string]bool)
+	for _, record := range desired {
+		if deleted[record.RecordType] {
+			continue
+		}
+		var current *provider.DNSRecord
+		for _, e := range existing {
+			if e.RecordType == record.RecordType {
+				current = e
+				break
+			}
+		}
+		if current == nil {
+			continue
+		}
+		deleted[record.RecordType] = true
+
+		h.logger.Info("deleting DNS record",
+			zap.String("domain", domain),
+			zap.String("record_type", record.RecordType),
+			zap.String("value", current.Value),
+			zap.String("provider", providerName))
+		if err := client.DeleteRecord(ctx, domain, record.RecordType); err != nil {
+			return "", err
+		}
+		h.app.recordDeleted(providerName, domain, record.RecordType, current.Value)
+		action = actionDeleted
+	}
+
+	if action == actionNoop && h.app.Debug {
+		h.logger.Debug("no DNS record to delete",
+			zap.String("domain", domain),
+			zap.String("provider", providerName))
+	}
+	return action, nil
+}
+
+// srvRecord returns the name and desired SRV record for domain if srv is
+// configured. Wildcard domains can't be SRV targets.
+func (h *Handler) srvRecord(domain string) (string, desiredRecord, bool) {
+	if h.SRV == nil || provider.IsWildcard(domain) {
+		return "", desiredRecord{}, false
+	}
+	name := fmt.Sprintf("_%s._%s.%s", strings.TrimPrefix(h.SRV.Service, "_"), strings.TrimPrefix(h.SRV.Proto, "_"), domain)
+	value := provider.SRVValue(h.SRV.Priority, h.SRV.Weight, h.SRV.Port, domain)
+	return name, desiredRecord{RecordType: "SRV", Value: value}, true
+}
+
+// reconcileRecord makes sure the record of the given type points to value
+// and returns what it did
+func (h *Handler) reconcileRecord(ctx context.Context, providerName string, client provider.DNSService, domain, recordType, value string, existing []*provider.DNSRecord) (string, error) {
+	enabled := !h.Disabled
+
+	var previous, ids []string
+	for _, record := range existing {
+		if record.RecordType != recordType {
+			continue
+		}
+		previous = append(previous, record.Value)
+		if record.UUID != "" {
+			ids = append(ids, record.UUID)
+		}
+
+		if !sameRecordValue(recordType, value, record.Value) {
+			continue
+		}
+
+		// Check if only the enabled state differs
+		if record.Enabled != enabled && h.CreateOnly {
+			h.logger.Warn("DNS record state differs, not changing it with create_only",
+				zap.String("domain", domain),
+				zap.String("record_type", recordType),
+				zap.Bool("enabled", record.Enabled),
+				zap.Bool("desired_enabled", enabled),
+				zap.String("provider", providerName))
+			return actionSkipped, nil
+		}
+		if record.Enabled != enabled {
+			h.logger.Info("changing DNS record state",
+				zap.String("domain", domain),
+				zap.String("record_type", recordType),
+				zap.Bool("enabled", enabled),
+				zap.String("id", record.UUID),
+				zap.String("provider", providerName))
+			if err := provider.SetEnabled(ctx, client, domain, recordType, enabled); err != nil {
+				return "", err
+			}
+			h.app.recordChanged("update", providerName, domain, recordType, value, record.UUID, nil)
+			return actionUpdated, nil
+		}
+
+		if h.app.Debug {
+			h.logger.Debug("DNS record already exists and is correct",
+				zap.String("domain", domain),
+				zap.String("record_type", recordType),
+				zap.String("provider", providerName))
+		}
+		h.app.touchRecord(providerName, domain, recordType)
+		return actionNoop, nil
+	}
+
+	if len(previous) > 0 && h.CreateOnly {
+		h.logger.Warn("DNS record differs, not updating it with create_only",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.Strings("current", previous),
+			zap.String("value", value),
+			zap.String("provider", providerName))
+		return actionSkipped, nil
+	}
+
+	if len(previous) > 0 {
+		// Update existing (possibly stale or duplicated) records of this type
+		h.logger.Info("updating existing DNS record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.Strings("previous", previous),
+			zap.Strings("ids", ids),
+			zap.String("value", value),
+			zap.String("provider", providerName))
+		var id string
+		unconfirmed, err := madeChange(client.UpdateRecord(provider.WithRecordID(ctx, &id), domain, recordType, value))
+		if err != nil {
+			return "", err
+		}
+		if !enabled {
+			if err := provider.SetEnabled(ctx, client, domain, recordType, false); err != nil {
+				return "", err
+			}
+		}
+		h.app.recordChanged("update", providerName, domain, recordType, value, id, previous)
+		if unconfirmed != nil {
+			return "", unconfirmed
+		}
+		return actionUpdated, nil
+	}
+
+	if !h.app.allowNewDomain(domain) {
+		return "", fmt.Errorf("refusing to create %s record for %s: max_records limit of %d domains reached",
+			recordType, domain, h.app.MaxRecords)
+	}
+
+	// Create new record
+	h.logger.Info("creating new DNS record",
+		zap.String("domain", domain),
+		zap.String("record_type", recordType),
+		zap.String("value", value),
+		zap.String("provider", providerName))
+	var id string
+	unconfirmed, err := madeChange(client.CreateRecord(provider.WithRecordID(ctx, &id), domain, recordType, value))
+	if err != nil {
+		return "", err
+	}
+	if id != "" {
+		h.logger.Info("DNS record created",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("id", id),
+			zap.String("provider", providerName))
+	}
+	if !enabled {
+		if err := provider.SetEnabled(ctx, client, domain, recordType, false); err != nil {
+			return "", err
+		}
+	}
+	h.app.recordChanged("create", providerName, domain, recordType, value, id, nil)
+	if unconfirmed != nil {
+		return "", unconfirmed
+	}
+	return actionCreated, nil
+}
+
+// madeChange splits the error of a change into one of await_apply, which
+// couldn't confirm a change that was made, and a failure. Changes that were
+// made must be tracked before the former is returned.
+func madeChange(err error) (unconfirmed, failed error) {
+	if errors.Is(err, provider.ErrNotConfirmed) {
+		return err, nil
+	}
+	return nil, err
+}
+
+// reconcileRecordSet makes sure domain has exactly one record of the given
+// type for each of values, e.g. for round-robin addresses. Missing records
+// are added; stale ones can only be removed with all records of the type,
+// so the set is recreated then.
+func (h *Handler) reconcileRecordSet(ctx context.Context, providerName string, client provider.DNSService, domain, recordType string, values []string, existing []*provider.DNSRecord) (string, error) {
+	enabled := !h.Disabled
+
+	var current []*provider.DNSRecord
+	var previous []string
+	for _, record := range existing {
+		if record.RecordType == recordType {
+			current = append(current, record)
+			previous = append(previous, record.Value)
+		}
+	}
+
+	var missing []string
+	for _, value := range values {
+		if !containsRecordValue(recordType, previous, value) {
+			missing = append(missing, value)
+		}
+	}
+	var stale []string
+	toggle := false
+	for _, record := range current {
+		if !containsRecordValue(recordType, values, record.Value) {
+			stale = append(stale, record.Value)
+		} else if record.Enabled != enabled {
+			toggle = true
+		}
+	}
+	joined := strings.Join(values, ",")
+
+	switch {
+	case len(missing) == 0 && len(stale) == 0 && !toggle:
+		if h.app.Debug {
+			h.logger.Debug("DNS records already exist and are correct",
+				zap.String("domain", domain),
+				zap.String("record_type", recordType),
+				zap.Strings("values", values),
+				zap.String("provider", providerName))
+		}
+		h.app.touchRecord(providerName, domain, recordType)
+		return actionNoop, nil
+
+	case len(current) > 0 && h.CreateOnly:
+		h.logger.Warn("DNS records differ, not updating them with create_only",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.Strings("current", previous),
+			zap.Strings("values", values),
+			zap.String("provider", providerName))
+		return actionSkipped, nil
+
+	case len(missing) == 0 && len(stale) == 0:
+		h.logger.Info("changing DNS record state",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.Bool("enabled", enabled),
+			zap.String("provider", providerName))
+		if err := provider.SetEnabled(ctx, client, domain, recordType, enabled); err != nil {
+			return "", err
+		}
+		h.app.recordChanged("update", providerName, domain, recordType, joined, "", nil)
+		return actionUpdated, nil
+
+	case len(stale) > 0:
+		h.logger.Info("replacing DNS records",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.Strings("previous", previous),
+			zap.Strings("values", values),
+			zap.String("provider", providerName))
+		if err := client.DeleteRecord(ctx, domain, recordType); err != nil {
+			return "", err
+		}
+		missing = values
+
+	default:
+		if len(current) == 0 && !h.app.allowNewDomain(domain) {
+			return "", fmt.Errorf("refusing to create %s records for %s: max_records limit of %d domains reached",
+				recordType, domain, h.app.MaxRecords)
+		}
+		h.logger.Info("adding DNS records",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.Strings("values", missing),
+			zap.String("provider", providerName))
+	}
+
+	var unconfirmed []error
+	for _, value := range missing {
+		notConfirmed, err := madeChange(client.CreateRecord(ctx, domain, recordType, value))
+		if err != nil {
+			return "", err
+		}
+		unconfirmed = append(unconfirmed, notConfirmed)
+	}
+	if !enabled {
+		if err := provider.SetEnabled(ctx, client, domain, recordType, false); err != nil {
+			return "", err
+		}
+	}
+
+	action := actionUpdated
+	if len(current) == 0 {
+		h.app.recordChanged("create", providerName, domain, recordType, joined, "", nil)
+		action = actionCreated
+	} else {
+		h.app.recordChanged("update", providerName, domain, recordType, joined, "", previous)
+	}
+	if err := errors.Join(unconfirmed...); err != nil {
+		return "", err
+	}
+	return action, nil
+}
+
+// containsRecordValue reports whether values contain value, compared with
+// sameRecordValue
+func containsRecordValue(recordType string, values []string, value string) bool {
+	for _, v := range values {
+		if sameRecordValue(recordType, v, value) {
+			return true
+		}
 	}
+	return false
+}
 
-	return nil
+// sameRecordValue compares IPs by address, host names case-insensitively and
+// TXT values exactly
+func sameRecordValue(recordType, a, b string) bool {
+	switch recordType {
+	case "A", "AAAA":
+		return net.ParseIP(a).Equal(net.ParseIP(b))
+	case "TXT":
+		return a == b
+	}
+	// Host names may be stored in either form
+	if asciiA, err := asciiDomain(a); err == nil {
+		a = asciiA
+	}
+	if asciiB, err := asciiDomain(b); err == nil {
+		b = asciiB
+	}
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
 }
 
-func (a *App) Start() error {
-	return nil
+// idnaProfile maps internationalized names for lookups like browsers do.
+// Wildcards and underscores, e.g. of SRV names, remain allowed.
+var idnaProfile = idna.New(idna.MapForLookup(), idna.Transitional(false), idna.StrictDomainName(false))
+
+// asciiDomain returns the punycode form of an internationalized domain, e.g.
+// xn--mnchen-3ya.example for münchen.example. ASCII domains are unchanged.
+func asciiDomain(domain string) (string, error) {
+	ascii := true
+	for i := 0; i < len(domain); i++ {
+		if domain[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return domain, nil
+	}
+
+	converted, err := idnaProfile.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("invalid internationalized domain %s: %w", domain, err)
+	}
+	return converted, nil
 }
 
-func (a *App) Stop() error {
-	return nil
+// queueSize is the number of domains that can wait for reconciliation
+const queueSize = 256
+
+// maxSeenDomains caps the domains reconciled periodically
+const maxSeenDomains = 10000
+
+// drainTimeout bounds how long Stop waits for the queued domains
+const drainTimeout = 30 * time.Second
+
+// Default backoff delays used when retry_attempts is set
+const (
+	defaultRetryDelay    = time.Second
+	defaultRetryMaxDelay = 30 * time.Second
+)
+
+// Defaults of failover_threshold and failover_cooldown
+const (
+	defaultFailoverThreshold = 3
+	defaultFailoverCooldown  = time.Minute
+)
+
+// defaultCacheTTL is used when cache_ttl is unset
+const defaultCacheTTL = 60 * time.Second
+
+// defaultIgnoreHosts is used when ignore_hosts is unset
+var defaultIgnoreHosts = []string{"localhost", "*.localhost"}
+
+// normalizeDomain lowercases domain and strips the trailing dot of the
+// fully-qualified form, so Example.COM. and example.com are the same record
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
 }
 
-func (a *App) createProvider(config *ProviderConfig) (provider.DNSService, error) {
-	switch config.Type {
-	case "opnsense":
-		return provider.NewOPNsenseProvider(config.Hostname, config.APIKey, config.APISecret, config.DNSService, config.Insecure, a.logger, a.Debug)
-	default:
-		return nil, fmt.Errorf("unsupported provider type: %s", config.Type)
+// stripPort removes the port of a host like example.com:443 or [::1]:8443.
+// Hosts without a port, including bare IPv6 literals, are returned as is.
+func stripPort(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return hostname
 	}
+	return host
 }
 
-// Handler methods
-func (Handler) CaddyModule() caddy.ModuleInfo {
-	return caddy.ModuleInfo{
-		ID:  "http.handlers.local_dns",
-		New: func() caddy.Module { return new(Handler) },
+// overrideDomain validates the value of domain_override and returns it in
+// punycode
+func overrideDomain(value string) (string, error) {
+	domain, err := asciiDomain(strings.TrimSuffix(strings.TrimSpace(value), "."))
+	if err != nil {
+		return "", err
+	}
+	if !validHostname(domain) || !strings.Contains(domain, ".") {
+		return "", fmt.Errorf("%q is not a host name with a dot", value)
 	}
+	return domain, nil
 }
 
-func (h *Handler) Provision(ctx caddy.Context) error {
-	h.logger = ctx.Logger(h)
+// apply rewrites domain and validates the result like domain_override
+func (rw *DomainRewrite) apply(domain string) (string, error) {
+	domain = normalizeDomain(domain)
+	if !rw.re.MatchString(domain) {
+		return domain, nil
+	}
+	return overrideDomain(rw.re.ReplaceAllString(domain, rw.Replace))
+}
 
-	// Get the app instance
-	appIface, err := ctx.App("local_dns")
-	if err != nil {
-		return fmt.Errorf("local_dns app not configured")
+// registeredDomain returns the registrable domain of host below the
+// private_suffixes or, otherwise, the public suffixes. Unknown TLDs count as
+// suffixes, so app.lan stays app.lan. IP addresses are returned as is.
+func (h *Handler) registeredDomain(host string) (string, error) {
+	host = normalizeDomain(host)
+	if net.ParseIP(host) != nil {
+		return host, nil
 	}
-	h.app = appIface.(*App)
 
-	if h.Provider == "" {
-		return errors.New("provider name is required")
+	for _, suffix := range h.PrivateSuffixes {
+		if host == suffix {
+			return "", fmt.Errorf("%s is a private suffix", host)
+		}
+		if rest, ok := strings.CutSuffix(host, "."+suffix); ok {
+			return rest[strings.LastIndexByte(rest, '.')+1:] + "." + suffix, nil
+		}
 	}
+	return publicsuffix.EffectiveTLDPlusOne(host)
+}
 
-	if _, exists := h.app.clients[h.Provider]; !exists {
-		return fmt.Errorf("provider %s not found in global configuration", h.Provider)
+// validHostname reports whether name consists of valid labels of letters,
+// digits and hyphens. Single labels are allowed for search domains.
+func validHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
 	}
+	return true
+}
 
-	return nil
+// wildcardDomain replaces the leftmost label of host with "*". Hosts with
+// fewer than three labels and IP addresses are returned unchanged, so an
+// apex like example.com never turns into *.com.
+func wildcardDomain(host string) string {
+	if net.ParseIP(host) != nil || strings.Count(host, ".") < 2 {
+		return host
+	}
+	return "*." + host[strings.IndexByte(host, '.')+1:]
 }
 
-func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
-	// Get the domain from the request
-	domain := r.Host
+// defaultDetectIPTarget is dialed to find the outbound IP for caddy_ip auto
+const defaultDetectIPTarget = "8.8.8.8:80"
 
-	// Remove port if present
-	if colonIndex := strings.LastIndex(domain, ":"); colonIndex != -1 {
-		domain = domain[:colonIndex]
+// interfaceIPInRange returns the first address of an up interface within
+// the CIDR range cidr
+func interfaceIPInRange(cidr string) (string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
 	}
 
-	// Handle the DNS record
-	if err := h.handleDomain(domain); err != nil {
-		h.logger.Error("failed to handle domain", zap.String("domain", domain), zap.Error(err))
-		// Don't fail the request, just log the error
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
 	}
-
-	return next.ServeHTTP(w, r)
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && network.Contains(ipNet.IP) {
+				return ipNet.IP.String(), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no local interface has an address in %s", cidr)
 }
 
-func (h *Handler) handleDomain(domain string) error {
-	provider, exists := h.app.clients[h.Provider]
-	if !exists {
-		return fmt.Errorf("provider %s not found", h.Provider)
+// detectOutboundIP returns the local IPv4 address used to reach target.
+// Dialing UDP sends no packets, it only selects a route and source address.
+func detectOutboundIP(target string) (string, error) {
+	conn, err := net.Dial("udp4", target)
+	if err != nil {
+		return "", err
 	}
+	defer conn.Close()
 
-	// Determine IP to use: ip_override takes precedence, then fall back to global caddy_ip
-	ip := h.IPOverride
-	if ip == "" {
-		ip = h.app.CaddyIP
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok || addr.IP.IsUnspecified() {
+		return "", fmt.Errorf("no usable local address for %s", target)
 	}
+	return addr.IP.String(), nil
+}
 
-	if ip == "" {
-		return errors.New("no IP address configured: set either ip_override in handler or caddy_ip in global config")
+// tag returns the tag of the records of domain
+func (h *Handler) tag(domain string) string {
+	tag := strings.ReplaceAll(h.Tag, "{domain}", domain)
+	return caddy.NewReplacer().ReplaceKnown(tag, "")
+}
+
+// templatedIPs reports whether ip_override contains placeholders
+func (h *Handler) templatedIPs() bool {
+	for _, ip := range h.IPOverride {
+		if strings.Contains(ip, "{") {
+			return true
+		}
 	}
+	return false
+}
 
-	// Validate IP
-	if net.ParseIP(ip) == nil {
-		return fmt.Errorf("invalid IP address: %s", ip)
+// resolveIPOverride replaces the placeholders of ip_override with repl and
+// returns the resulting addresses. A placeholder may expand to a
+// comma-separated list.
+func (h *Handler) resolveIPOverride(repl *caddy.Replacer) ([]string, error) {
+	var ips []string
+	for _, value := range h.IPOverride {
+		for _, ip := range strings.Split(repl.ReplaceAll(value, ""), ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				ips = append(ips, ip)
+			}
+		}
 	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s resolved to no IP address", strings.Join(h.IPOverride, ","))
+	}
+	if err := validateIPs(ips); err != nil {
+		return nil, err
+	}
+	return ips, nil
+}
 
-	h.logger.Info("handling domain",
-		zap.String("domain", domain),
-		zap.String("ip", ip),
-		zap.String("provider", h.Provider))
+// validateIPs checks that every address parses and is listed once.
+// Several addresses of a family are managed as a record set.
+func validateIPs(ips []string) error {
+	seen := make(map[string]bool)
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return fmt.Errorf("invalid IP address: %s", ip)
+		}
+		if seen[parsed.String()] {
+			return fmt.Errorf("IP address %s configured twice", ip)
+		}
+		seen[parsed.String()] = true
+	}
+	return nil
+}
 
-	// Check if record exists
-	existing, err := provider.FindRecord(domain)
+// parseDuration reads a single duration argument
+func parseDuration(d *caddyfile.Dispenser) (caddy.Duration, error) {
+	if !d.NextArg() {
+		return 0, d.ArgErr()
+	}
+	dur, err := caddy.ParseDuration(d.Val())
 	if err != nil {
-		return fmt.Errorf("failed to find existing record: %w", err)
+		return 0, d.Errf("invalid duration %s: %v", d.Val(), err)
 	}
+	return caddy.Duration(dur), nil
+}
 
-	if existing != nil {
-		// Check if update is needed
-		if existing.IP == ip && existing.Enabled {
-			h.logger.Info("DNS record already exists and is correct", zap.String("domain", domain))
-			return nil
+// parseIPList collects the remaining arguments on the line, splitting
+// comma-separated values, so both "a b" and "a,b" are accepted.
+func parseIPList(d *caddyfile.Dispenser) ([]string, error) {
+	var ips []string
+	for _, arg := range d.RemainingArgs() {
+		for _, ip := range strings.Split(arg, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				ips = append(ips, ip)
+			}
 		}
-
-		// Update existing record
-		h.logger.Info("updating existing DNS record", zap.String("domain", domain))
-		return provider.UpdateRecord(domain, ip)
 	}
-
-	// Create new record
-	h.logger.Info("creating new DNS record", zap.String("domain", domain))
-	return provider.CreateRecord(domain, ip)
+	if len(ips) == 0 {
+		return nil, d.ArgErr()
+	}
+	return ips, nil
 }
 
 // Caddyfile unmarshaling for App (global config)
@@ -244,35 +3067,527 @@ func (a *App) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 						if !d.AllArgs(&config.DNSService) {
 							return d.ArgErr()
 						}
+					case "reconfigure_delay":
+						delay, err := parseDuration(d)
+						if err != nil {
+							return err
+						}
+						config.ReconfigureDelay = delay
+					case "max_idle_conns":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						limit, err := strconv.Atoi(d.Val())
+						if err != nil || limit < 0 {
+							return d.Errf("invalid max_idle_conns: %s", d.Val())
+						}
+						config.MaxIdleConns = limit
+					case "idle_conn_timeout":
+						timeout, err := parseDuration(d)
+						if err != nil {
+							return err
+						}
+						config.IdleConnTimeout = timeout
+					case "keep_alive":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						keepAlive, err := strconv.ParseBool(d.Val())
+						if err != nil {
+							return d.Errf("invalid keep_alive: %s", d.Val())
+						}
+						config.KeepAlive = &keepAlive
+					case "auth_mode":
+						if !d.AllArgs(&config.AuthMode) {
+							return d.ArgErr()
+						}
+					case "auto_apply":
+						// A bare auto_apply enables it
+						autoApply := true
+						if d.NextArg() {
+							var err error
+							if autoApply, err = strconv.ParseBool(d.Val()); err != nil {
+								return d.Errf("invalid auto_apply: %s", d.Val())
+							}
+						}
+						config.AutoApply = &autoApply
+					case "await_apply":
+						timeout, err := parseDuration(d)
+						if err != nil {
+							return err
+						}
+						config.AwaitApply = timeout
+					case "await_interval":
+						interval, err := parseDuration(d)
+						if err != nil {
+							return err
+						}
+						config.AwaitInterval = interval
+					case "comment":
+						if !d.AllArgs(&config.Comment) {
+							return d.ArgErr()
+						}
+					case "zone":
+						if !d.AllArgs(&config.Zone) {
+							return d.ArgErr()
+						}
+					case "zones":
+						zones := d.RemainingArgs()
+						if len(zones) == 0 {
+							return d.ArgErr()
+						}
+						config.Zones = append(config.Zones, zones...)
+					case "zone_id":
+						if !d.AllArgs(&config.ZoneID) {
+							return d.ArgErr()
+						}
+					case "proxied":
+						config.Proxied = true
+					case "profile_id":
+						if !d.AllArgs(&config.ProfileID) {
+							return d.ArgErr()
+						}
+					case "site":
+						if !d.AllArgs(&config.Site) {
+							return d.ArgErr()
+						}
+					case "endpoints":
+						endpoints := d.RemainingArgs()
+						if len(endpoints) == 0 {
+							return d.ArgErr()
+						}
+						config.Endpoints = append(config.Endpoints, endpoints...)
+					case "prefix":
+						if !d.AllArgs(&config.Prefix) {
+							return d.ArgErr()
+						}
+					case "client_cert":
+						if !d.AllArgs(&config.ClientCert) {
+							return d.ArgErr()
+						}
+					case "client_key":
+						if !d.AllArgs(&config.ClientKey) {
+							return d.ArgErr()
+						}
+					case "tsig_key":
+						if !d.AllArgs(&config.TSIGKey) {
+							return d.ArgErr()
+						}
+					case "tsig_secret":
+						if !d.AllArgs(&config.TSIGSecret) {
+							return d.ArgErr()
+						}
+					case "tsig_algorithm":
+						if !d.AllArgs(&config.TSIGAlgorithm) {
+							return d.ArgErr()
+						}
+					case "key_file":
+						if !d.AllArgs(&config.KeyFile) {
+							return d.ArgErr()
+						}
+					case "nsupdate_path":
+						if !d.AllArgs(&config.NsupdatePath) {
+							return d.ArgErr()
+						}
+					case "knot_socket":
+						if !d.AllArgs(&config.KnotSocket) {
+							return d.ArgErr()
+						}
+					case "knotc_path":
+						if !d.AllArgs(&config.KnotcPath) {
+							return d.ArgErr()
+						}
+					case "ssh_user":
+						if !d.AllArgs(&config.SSHUser) {
+							return d.ArgErr()
+						}
+					case "ssh_key":
+						if !d.AllArgs(&config.SSHKey) {
+							return d.ArgErr()
+						}
+					case "known_hosts":
+						if !d.AllArgs(&config.KnownHosts) {
+							return d.ArgErr()
+						}
+					case "hosts_file":
+						if !d.AllArgs(&config.HostsFile) {
+							return d.ArgErr()
+						}
 					case "insecure":
 						config.Insecure = true
+					case "ca_cert":
+						if !d.AllArgs(&config.CACert) {
+							return d.ArgErr()
+						}
+					case "skip_hostname_verify":
+						config.SkipHostnameVerify = true
+					case "ttl":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						ttl, err := strconv.Atoi(d.Val())
+						if err != nil || ttl < 0 {
+							return d.Errf("invalid ttl: %s", d.Val())
+						}
+						config.TTL = ttl
+					case "timeout":
+						timeout, err := parseDuration(d)
+						if err != nil {
+							return err
+						}
+						config.Timeout = timeout
+					case "user_agent":
+						if !d.AllArgs(&config.UserAgent) {
+							return d.ArgErr()
+						}
+					case "header":
+						var header, value string
+						if !d.AllArgs(&header, &value) {
+							return d.ArgErr()
+						}
+						if config.Headers == nil {
+							config.Headers = make(map[string]string)
+						}
+						config.Headers[header] = value
 					}
 				}
 
 				a.Providers[providerName] = config
 			case "caddy_ip":
-				if !d.AllArgs(&a.CaddyIP) {
+				ips, err := parseIPList(d)
+				if err != nil {
+					return err
+				}
+				a.CaddyIP = ips
+			case "detect_ip_target":
+				if !d.AllArgs(&a.DetectIPTarget) {
+					return d.ArgErr()
+				}
+			case "default_provider":
+				if !d.AllArgs(&a.DefaultProvider) {
+					return d.ArgErr()
+				}
+			case "retry_attempts":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				attempts, err := strconv.Atoi(d.Val())
+				if err != nil || attempts < 1 {
+					return d.Errf("invalid retry_attempts: %s", d.Val())
+				}
+				a.RetryAttempts = attempts
+			case "failover_threshold":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				threshold, err := strconv.Atoi(d.Val())
+				if err != nil || threshold < 1 {
+					return d.Errf("invalid failover_threshold: %s", d.Val())
+				}
+				a.FailoverThreshold = threshold
+			case "failover_cooldown":
+				cooldown, err := parseDuration(d)
+				if err != nil {
+					return err
+				}
+				a.FailoverCooldown = cooldown
+			case "worker_concurrency":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				workers, err := strconv.Atoi(d.Val())
+				if err != nil || workers < 1 {
+					return d.Errf("invalid worker_concurrency: %s", d.Val())
+				}
+				a.WorkerConcurrency = workers
+			case "max_records":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				limit, err := strconv.Atoi(d.Val())
+				if err != nil || limit < 0 {
+					return d.Errf("invalid max_records: %s", d.Val())
+				}
+				a.MaxRecords = limit
+			case "retry_delay":
+				delay, err := parseDuration(d)
+				if err != nil {
+					return err
+				}
+				a.RetryDelay = delay
+			case "retry_max_delay":
+				delay, err := parseDuration(d)
+				if err != nil {
+					return err
+				}
+				a.RetryMaxDelay = delay
+			case "rate_limit":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				limit, err := strconv.ParseFloat(d.Val(), 64)
+				if err != nil || limit <= 0 {
+					return d.Errf("invalid rate_limit: %s", d.Val())
+				}
+				a.RateLimit = limit
+			case "cache_ttl":
+				if !d.NextArg() {
 					return d.ArgErr()
 				}
+				if d.Val() == "off" {
+					a.CacheTTL = -1
+					break
+				}
+				ttl, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid cache_ttl %s: %v", d.Val(), err)
+				}
+				a.CacheTTL = caddy.Duration(ttl)
+			case "metrics":
+				a.Metrics = true
+			case "skip_validation":
+				a.SkipValidation = true
+			case "reconcile_interval":
+				interval, err := parseDuration(d)
+				if err != nil {
+					return err
+				}
+				a.ReconcileInterval = interval
+			case "record_idle_timeout":
+				timeout, err := parseDuration(d)
+				if err != nil {
+					return err
+				}
+				a.RecordIdleTimeout = timeout
 			case "debug":
 				a.Debug = true
+			case "debug_providers":
+				a.DebugProviders = true
+			case "cleanup_on_stop":
+				a.CleanupOnStop = true
+			case "state_file":
+				if !d.AllArgs(&a.StateFile) {
+					return d.ArgErr()
+				}
+			case "prune_stale":
+				a.PruneStale = true
+			case "dry_run":
+				a.DryRun = true
+			case "webhook_url":
+				if !d.AllArgs(&a.WebhookURL) {
+					return d.ArgErr()
+				}
+			case "ignore_hosts":
+				hosts := d.RemainingArgs()
+				if len(hosts) == 0 {
+					return d.ArgErr()
+				}
+				a.IgnoreHosts = append(a.IgnoreHosts, hosts...)
+			case "batch_window":
+				window, err := parseDuration(d)
+				if err != nil {
+					return err
+				}
+				a.BatchWindow = window
 			}
 		}
 	}
 	return nil
 }
 
+// parseSRV parses an srv block
+func parseSRV(d *caddyfile.Dispenser) (*SRVConfig, error) {
+	srv := &SRVConfig{}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		option := d.Val()
+		switch option {
+		case "service":
+			if !d.AllArgs(&srv.Service) {
+				return nil, d.ArgErr()
+			}
+		case "proto":
+			if !d.AllArgs(&srv.Proto) {
+				return nil, d.ArgErr()
+			}
+		case "port", "priority", "weight":
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			value, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, d.Errf("invalid srv %s: %s", option, d.Val())
+			}
+			switch option {
+			case "port":
+				srv.Port = value
+			case "priority":
+				srv.Priority = value
+			case "weight":
+				srv.Weight = value
+			}
+		default:
+			return nil, d.Errf("unknown srv option: %s", option)
+		}
+	}
+	return srv, nil
+}
+
 // Caddyfile unmarshaling for Handler (site-specific config)
 func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 	for d.Next() {
-		if d.NextArg() {
-			h.Provider = d.Val()
+		h.Providers = append(h.Providers, d.RemainingArgs()...)
+
+		for nesting := d.Nesting(); d.NextBlock(nesting); {
+			switch d.Val() {
+			case "ip_override":
+				ips, err := parseIPList(d)
+				if err != nil {
+					return err
+				}
+				h.IPOverride = ips
+			case "wildcard":
+				h.Wildcard = true
+			case "cname":
+				if !d.AllArgs(&h.CNAME) {
+					return d.ArgErr()
+				}
+			case "use_forwarded_host":
+				h.UseForwardedHost = true
+			case "prefer_sni":
+				h.PreferSNI = true
+			case "domain_override":
+				if !d.AllArgs(&h.DomainOverride) {
+					return d.ArgErr()
+				}
+			case "require_app":
+				h.RequireApp = true
+			case "registered_domain":
+				h.RegisteredDomain = true
+				h.PrivateSuffixes = append(h.PrivateSuffixes, d.RemainingArgs()...)
+			case "rewrite_domain":
+				h.RewriteDomain = new(DomainRewrite)
+				if !d.AllArgs(&h.RewriteDomain.Find, &h.RewriteDomain.Replace) {
+					return d.ArgErr()
+				}
+			case "tag":
+				if !d.AllArgs(&h.Tag) {
+					return d.ArgErr()
+				}
+			case "txt":
+				if !d.AllArgs(&h.TXT) {
+					return d.ArgErr()
+				}
+			case "disabled":
+				h.Disabled = true
+			case "require_tls":
+				h.RequireTLS = true
+			case "create_ptr":
+				h.CreatePTR = true
+			case "failover":
+				h.Failover = true
+			case "debug_headers":
+				h.DebugHeaders = true
+			case "mode":
+				if !d.AllArgs(&h.Mode) {
+					return d.ArgErr()
+				}
+			case "respect_wildcards":
+				h.RespectWildcards = true
+			case "create_only":
+				h.CreateOnly = true
+			case "split_horizon":
+				for nesting := d.Nesting(); d.NextBlock(nesting); {
+					rule := &SplitHorizonRule{Range: d.Val()}
+					ips, err := parseIPList(d)
+					if err != nil {
+						return err
+					}
+					rule.IPs = ips
+					h.SplitHorizon = append(h.SplitHorizon, rule)
+				}
+			case "srv":
+				srv, err := parseSRV(d)
+				if err != nil {
+					return err
+				}
+				h.SRV = srv
+			case "ip_from_header":
+				if !d.AllArgs(&h.IPFromHeader) {
+					return d.ArgErr()
+				}
+			case "record_type":
+				if !d.AllArgs(&h.RecordType) {
+					return d.ArgErr()
+				}
+			case "domains":
+				domains := d.RemainingArgs()
+				if len(domains) == 0 {
+					return d.ArgErr()
+				}
+				h.Domains = append(h.Domains, domains...)
+			case "alias":
+				aliases := d.RemainingArgs()
+				if len(aliases) == 0 {
+					return d.ArgErr()
+				}
+				h.Alias = append(h.Alias, aliases...)
+			case "prefixes":
+				prefixes := d.RemainingArgs()
+				if len(prefixes) == 0 {
+					return d.ArgErr()
+				}
+				h.Prefixes = append(h.Prefixes, prefixes...)
+			case "on_error":
+				if !d.AllArgs(&h.OnError) {
+					return d.ArgErr()
+				}
+			case "exclude":
+				patterns := d.RemainingArgs()
+				if len(patterns) == 0 {
+					return d.ArgErr()
+				}
+				h.Exclude = append(h.Exclude, patterns...)
+			case "allowed_pattern":
+				patterns := d.RemainingArgs()
+				if len(patterns) == 0 {
+					return d.ArgErr()
+				}
+				h.AllowedPattern = append(h.AllowedPattern, patterns...)
+			case "only_on":
+				args := d.RemainingArgs()
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+				if h.OnlyOn == nil {
+					h.OnlyOn = new(OnlyOnConfig)
+				}
+				h.OnlyOn.add(args)
+			}
 		}
-		// No block parsing needed since we removed caddy_ip from handler
 	}
 	return nil
 }
 
+// add sorts only_on arguments into methods and paths, which start with
+// "/" or "*". A leading "!" skips the method or path instead.
+func (c *OnlyOnConfig) add(args []string) {
+	for _, arg := range args {
+		skip := strings.HasPrefix(arg, "!")
+		arg = strings.TrimPrefix(arg, "!")
+		isPath := strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, "*")
+		switch {
+		case isPath && skip:
+			c.SkipPaths = append(c.SkipPaths, arg)
+		case isPath:
+			c.Paths = append(c.Paths, arg)
+		case skip:
+			c.SkipMethods = append(c.SkipMethods, strings.ToUpper(arg))
+		default:
+			c.Methods = append(c.Methods, strings.ToUpper(arg))
+		}
+	}
+}
+
 // Interface compliance
 var (
 	_ caddy.App                   = (*App)(nil)
@@ -0,0 +1,596 @@
+package local_dns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/mietzen/caddy-local-dns/provider"
+	"go.uber.org/zap"
+)
+
+// newTestApp returns an app with a memory provider named "memory", set up
+// like Provision does it
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := provider.NewMemoryProvider(zap.NewNop(), false)
+	return &App{
+		Providers:    map[string]*ProviderConfig{"memory": {Type: "memory"}},
+		logger:       zap.NewNop(),
+		clients:      map[string]provider.DNSService{"memory": client},
+		batchers:     make(map[string]provider.Batcher),
+		rawClients:   map[string]provider.DNSService{"memory": client},
+		providerKeys: make(map[string]string),
+		mu:           new(sync.Mutex),
+		stateMu:      new(sync.Mutex),
+		managed:      make(map[managedKey]*managedRecord),
+		domainLocks:  make(map[string]*domainLock),
+		health:       make(map[string]*providerHealth),
+		queue:        make(chan queuedDomain, queueSize),
+		pending:      make(map[queuedDomain]bool),
+		seen:         make(map[queuedDomain]queuedDomain),
+		done:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// newTestHandler returns a handler of app registering ips with its providers
+func newTestHandler(app *App, ips ...string) *Handler {
+	return &Handler{
+		Providers:  []string{"memory"},
+		IPOverride: ips,
+		logger:     zap.NewNop(),
+		app:        app,
+	}
+}
+
+// recordValues returns the sorted values of the records of domain and type
+func recordValues(t *testing.T, client provider.DNSService, domain, recordType string) []string {
+	t.Helper()
+
+	records, err := client.FindRecord(context.Background(), domain)
+	if err != nil {
+		t.Fatalf("FindRecord(%s): %v", domain, err)
+	}
+	var values []string
+	for _, record := range records {
+		if record.RecordType == recordType {
+			values = append(values, record.Value)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func TestShrinkRecordSet(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	client := app.clients["memory"]
+
+	h := newTestHandler(app, "192.168.1.61", "192.168.1.62")
+	if _, err := h.handleDomain(ctx, "app.example.com", ""); err != nil {
+		t.Fatalf("handleDomain with two addresses: %v", err)
+	}
+	if got := recordValues(t, client, "app.example.com", "A"); len(got) != 2 {
+		t.Fatalf("expected 2 A records, got %v", got)
+	}
+
+	h.IPOverride = []string{"192.168.1.61"}
+	action, err := h.handleDomain(ctx, "app.example.com", "")
+	if err != nil {
+		t.Fatalf("handleDomain with one address: %v", err)
+	}
+	if action != actionUpdated {
+		t.Errorf("expected action %s, got %s", actionUpdated, action)
+	}
+	if got := recordValues(t, client, "app.example.com", "A"); len(got) != 1 || got[0] != "192.168.1.61" {
+		t.Errorf("expected only 192.168.1.61 to remain, got %v", got)
+	}
+}
+
+func TestReloadWithCleanupOnStop(t *testing.T) {
+	ctx := context.Background()
+	previous := newTestApp(t)
+	previous.CleanupOnStop = true
+	client := previous.clients["memory"]
+
+	h := newTestHandler(previous, "192.168.1.50")
+	if _, err := h.handleDomain(ctx, "app.example.com", ""); err != nil {
+		t.Fatalf("handleDomain: %v", err)
+	}
+	if err := previous.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// Caddy provisions and starts the new config before stopping the old one
+	next := newTestApp(t)
+	next.CleanupOnStop = true
+	next.clients["memory"] = client
+	next.rawClients["memory"] = client
+	next.takeOverRecords(currentApp())
+	if err := next.Start(); err != nil {
+		t.Fatalf("Start after reload: %v", err)
+	}
+	if err := previous.Stop(); err != nil {
+		t.Fatalf("Stop of the previous config: %v", err)
+	}
+
+	if got := recordValues(t, client, "app.example.com", "A"); len(got) != 1 {
+		t.Fatalf("expected the record to survive the reload, got %v", got)
+	}
+	if records := next.ManagedRecords(); len(records) != 1 || records[0].Domain != "app.example.com" {
+		t.Fatalf("expected the new config to track the record, got %+v", records)
+	}
+
+	if err := next.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if got := recordValues(t, client, "app.example.com", "A"); len(got) != 0 {
+		t.Errorf("expected cleanup_on_stop to delete the record on the final stop, got %v", got)
+	}
+}
+
+func TestReloadKeepsStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	previous := newTestApp(t)
+	previous.StateFile = stateFile
+	if err := previous.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	previous.trackRecord("memory", "old.example.com", "A", "192.168.1.40", "")
+
+	next := newTestApp(t)
+	next.StateFile = stateFile
+	next.takeOverRecords(currentApp())
+	if err := next.Start(); err != nil {
+		t.Fatalf("Start after reload: %v", err)
+	}
+	next.trackRecord("memory", "new.example.com", "A", "192.168.1.50", "")
+
+	// The stopping app must not overwrite the state of the new one
+	if err := previous.Stop(); err != nil {
+		t.Fatalf("Stop of the previous config: %v", err)
+	}
+	defer next.Stop()
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("reading state file: %v", err)
+	}
+	var records []ManagedRecordInfo
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatalf("parsing state file: %v", err)
+	}
+	domains := make(map[string]bool)
+	for _, record := range records {
+		domains[record.Domain] = true
+	}
+	if !domains["old.example.com"] || !domains["new.example.com"] {
+		t.Errorf("expected the state of the new config with both records, got %+v", records)
+	}
+}
+
+func TestConfiguredNames(t *testing.T) {
+	hosts := []string{"app.lan", "*.apps.lan"}
+	tests := []struct {
+		name    string
+		handler *Handler
+		want    []string
+	}{
+		{"plain", &Handler{}, hosts},
+		{"domain_override", &Handler{DomainOverride: "app.example.com"}, []string{"app.example.com"}},
+		{"rewrite_domain", &Handler{RewriteDomain: &DomainRewrite{
+			Replace: "$1.example.com",
+			re:      regexp.MustCompile(`^(.+)\.lan$`),
+		}}, []string{"app.example.com", "*.apps.example.com"}},
+		{"registered_domain", &Handler{
+			RegisteredDomain: true,
+			PrivateSuffixes:  []string{"lan"},
+		}, []string{"app.lan", "apps.lan"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := append([]string(nil), tt.handler.configuredNames(hosts)...)
+			sort.Strings(got)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("configuredNames() = %v, want %v", got, want)
+			}
+			for _, name := range want {
+				if !configuredDomain(append(hosts, got...), name) {
+					t.Errorf("%s isn't configured, pruneStale would delete it", name)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffWithFailover(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	for _, name := range []string{"primary", "secondary"} {
+		client := provider.NewMemoryProvider(zap.NewNop(), false)
+		app.Providers[name] = &ProviderConfig{Type: "memory"}
+		app.clients[name] = client
+		app.rawClients[name] = client
+	}
+
+	h := newTestHandler(app, "192.168.1.50")
+	h.Providers = []string{"primary", "secondary"}
+	h.Failover = true
+	if _, err := h.handleDomain(ctx, "app.example.com", ""); err != nil {
+		t.Fatalf("handleDomain: %v", err)
+	}
+	app.hosts = []string{"app.example.com"}
+	app.remember(queuedDomain{handler: h, domain: "app.example.com"})
+
+	// Only the provider failover syncs is compared
+	diffs := app.Diff(ctx)
+	if len(diffs) != 1 || diffs[0].Provider != "primary" || diffs[0].Status != "ok" {
+		t.Fatalf("expected primary to be in sync, got %+v", diffs)
+	}
+
+	app.health["primary"] = &providerHealth{downUntil: time.Now().Add(time.Minute)}
+	diffs = app.Diff(ctx)
+	if len(diffs) != 1 || diffs[0].Provider != "secondary" || diffs[0].Status != "missing" {
+		t.Fatalf("expected secondary to miss the record while primary is down, got %+v", diffs)
+	}
+}
+
+func TestRememberOnlyConfiguredDomains(t *testing.T) {
+	app := newTestApp(t)
+	app.hosts = []string{"*.example.com"}
+	h := newTestHandler(app)
+
+	app.remember(queuedDomain{handler: h, domain: "app.example.com", ip: "192.168.1.50"})
+	app.remember(queuedDomain{handler: h, domain: "app.example.com", ip: "192.168.1.51"})
+	app.remember(queuedDomain{handler: h, domain: "spoofed.attacker.test", ip: "192.168.1.50"})
+
+	if len(app.seen) != 1 {
+		t.Fatalf("expected one known domain, got %v", app.seen)
+	}
+	item := app.seen[queuedDomain{handler: h, domain: "app.example.com"}]
+	if item.ip != "192.168.1.51" {
+		t.Errorf("expected the IP of the last request, got %q", item.ip)
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.com", "example.com"},
+		{"App.Example.COM", "app.example.com"},
+		{"app.example.com.", "app.example.com"},
+		{"App.Example.com.", "app.example.com"},
+		{"*.Example.com", "*.example.com"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeDomain(tt.domain); got != tt.want {
+			t.Errorf("normalizeDomain(%q) = %q, want %q", tt.domain, got, tt.want)
+		}
+	}
+}
+
+// appJSON is the app of the Caddyfile in TestAppJSONConfig in the JSON
+// shape documented in the Readme
+const appJSON = `{
+	"providers": {
+		"lan": {
+			"type": "memory",
+			"ttl": 300,
+			"timeout": "10s",
+			"zones": ["lan", "home.example.com"],
+			"headers": {"X-Team": "infra"}
+		}
+	},
+	"caddy_ip": ["192.168.1.50", "fd00::50"],
+	"default_provider": "lan",
+	"retry_attempts": 3,
+	"retry_delay": "1s",
+	"retry_max_delay": "30s",
+	"rate_limit": 5,
+	"failover_threshold": 2,
+	"failover_cooldown": "1m",
+	"max_records": 500,
+	"cache_ttl": "1m",
+	"reconcile_interval": "15m",
+	"record_idle_timeout": "72h",
+	"batch_window": "2s",
+	"skip_validation": true,
+	"ignore_hosts": ["localhost", "*.test"]
+}`
+
+// handlerJSON is the handler of the Caddyfile in TestHandlerJSONConfig in
+// the JSON shape documented in the Readme
+const handlerJSON = `{
+	"handler": "local_dns",
+	"providers": ["lan"],
+	"ip_override": ["192.168.1.60", "fd00::60"],
+	"record_type": "auto",
+	"alias": ["app.lan"],
+	"prefixes": ["www"],
+	"exclude": ["*.internal.example.com"],
+	"allowed_pattern": ["*.example.com"],
+	"txt": "managed by caddy",
+	"split_horizon": [
+		{"range": "192.168.0.0/16", "ips": ["192.168.1.50"]},
+		{"range": "0.0.0.0/0", "ips": ["203.0.113.10"]}
+	],
+	"srv": {"service": "minecraft", "proto": "tcp", "port": 25565},
+	"only_on": {"methods": ["GET", "HEAD"], "skip_paths": ["/healthz"]},
+	"ip_from_header": "X-Real-IP",
+	"on_error": "fail",
+	"create_ptr": true,
+	"failover": true,
+	"respect_wildcards": true,
+	"require_tls": true,
+	"disabled": true
+}`
+
+func TestAppJSONConfig(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	local_dns {
+		provider lan memory {
+			ttl 300
+			timeout 10s
+			zones lan home.example.com
+			header X-Team infra
+		}
+		caddy_ip 192.168.1.50 fd00::50
+		default_provider lan
+		retry_attempts 3
+		retry_delay 1s
+		retry_max_delay 30s
+		rate_limit 5
+		failover_threshold 2
+		failover_cooldown 1m
+		max_records 500
+		cache_ttl 1m
+		reconcile_interval 15m
+		record_idle_timeout 72h
+		batch_window 2s
+		skip_validation
+		ignore_hosts localhost *.test
+	}`)
+	fromCaddyfile := new(App)
+	if err := fromCaddyfile.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile: %v", err)
+	}
+
+	fromJSON := new(App)
+	if err := json.Unmarshal([]byte(appJSON), fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(fromJSON, fromCaddyfile) {
+		t.Errorf("JSON config differs from the Caddyfile:\n got %+v\nwant %+v", fromJSON, fromCaddyfile)
+	}
+}
+
+func TestHandlerJSONConfig(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	local_dns lan {
+		ip_override 192.168.1.60 fd00::60
+		record_type auto
+		alias app.lan
+		prefixes www
+		exclude *.internal.example.com
+		allowed_pattern *.example.com
+		txt "managed by caddy"
+		split_horizon {
+			192.168.0.0/16 192.168.1.50
+			0.0.0.0/0 203.0.113.10
+		}
+		srv {
+			service minecraft
+			proto tcp
+			port 25565
+		}
+		only_on GET HEAD !/healthz
+		ip_from_header X-Real-IP
+		on_error fail
+		create_ptr
+		failover
+		respect_wildcards
+		require_tls
+		disabled
+	}`)
+	fromCaddyfile := new(Handler)
+	if err := fromCaddyfile.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile: %v", err)
+	}
+
+	// "handler" is the module name, Caddy strips it before unmarshaling
+	fromJSON := new(Handler)
+	if err := json.Unmarshal([]byte(handlerJSON), fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(fromJSON, fromCaddyfile) {
+		t.Errorf("JSON config differs from the Caddyfile:\n got %+v\nwant %+v", fromJSON, fromCaddyfile)
+	}
+}
+
+func TestJSONConfigProvisions(t *testing.T) {
+	config := `{
+		"apps": {
+			"local_dns": ` + appJSON + `,
+			"http": {
+				"servers": {
+					"srv0": {
+						"listen": ["127.0.0.1:0"],
+						"automatic_https": {"disable": true},
+						"routes": [{
+							"match": [{"host": ["app.example.com"]}],
+							"handle": [` + handlerJSON + `]
+						}]
+					}
+				}
+			}
+		}
+	}`
+
+	var cfg caddy.Config
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if err := caddy.Validate(&cfg); err != nil {
+		t.Errorf("provisioning the JSON config failed: %v", err)
+	}
+}
+
+func TestStripPort(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"example.com:443", "example.com"},
+		{"[::1]:8443", "::1"},
+		{"::1", "::1"},
+		{"192.168.1.50:80", "192.168.1.50"},
+	}
+	for _, tt := range tests {
+		if got := stripPort(tt.host); got != tt.want {
+			t.Errorf("stripPort(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+// pendingService never returns records, like a provider that applies
+// changes after await_apply gave up
+type pendingService struct {
+	provider.DNSService
+}
+
+func (s pendingService) FindRecord(ctx context.Context, domain string) ([]*provider.DNSRecord, error) {
+	return nil, nil
+}
+
+func TestUnconfirmedChangeIsTracked(t *testing.T) {
+	app := newTestApp(t)
+	app.clients["memory"] = provider.NewAwaitService(pendingService{app.clients["memory"]}, 10*time.Millisecond, time.Millisecond, zap.NewNop())
+
+	h := newTestHandler(app, "192.168.1.50")
+	_, err := h.handleDomain(context.Background(), "app.example.com", "")
+	if !errors.Is(err, provider.ErrNotConfirmed) {
+		t.Fatalf("expected ErrNotConfirmed, got %v", err)
+	}
+	if records := app.ManagedRecords(); len(records) != 1 || records[0].Domain != "app.example.com" {
+		t.Errorf("expected the unconfirmed record to be tracked, got %+v", records)
+	}
+}
+
+// drainOnStop queues domains before the workers start and checks that Stop
+// handles all of them
+func drainOnStop(t *testing.T, workers int) {
+	t.Helper()
+
+	app := newTestApp(t)
+	app.WorkerConcurrency = workers
+	client := app.clients["memory"]
+	h := newTestHandler(app, "192.168.1.50")
+
+	var domains []string
+	for i := range 20 {
+		domain := fmt.Sprintf("app%d.example.com", i)
+		domains = append(domains, domain)
+		app.enqueue(h, domain, "")
+	}
+	if err := app.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := app.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	for _, domain := range domains {
+		if got := recordValues(t, client, domain, "A"); len(got) != 1 {
+			t.Errorf("expected the queued domain %s to be handled on shutdown, got %v", domain, got)
+		}
+	}
+}
+
+func TestStopDrainsQueue(t *testing.T) {
+	drainOnStop(t, 1)
+}
+
+func TestStopDrainsQueueWithConcurrentWorkers(t *testing.T) {
+	drainOnStop(t, 4)
+}
+
+func TestDiffBypassesCache(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	backend := app.clients["memory"]
+	app.clients["memory"] = provider.NewCachedService(backend, time.Hour)
+
+	h := newTestHandler(app, "192.168.1.50")
+	if _, err := h.handleDomain(ctx, "app.example.com", ""); err != nil {
+		t.Fatalf("handleDomain: %v", err)
+	}
+	app.hosts = []string{"app.example.com"}
+	app.remember(queuedDomain{handler: h, domain: "app.example.com"})
+
+	// Fill the cache, then remove the record on the DNS server
+	if diffs := app.Diff(ctx); len(diffs) != 1 || diffs[0].Status != "ok" {
+		t.Fatalf("expected the record to be in sync, got %+v", diffs)
+	}
+	if err := backend.DeleteRecord(ctx, "app.example.com", "A"); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+
+	if diffs := app.Diff(ctx); len(diffs) != 1 || diffs[0].Status != "missing" {
+		t.Errorf("expected the deleted record to be missing, got %+v", diffs)
+	}
+}
+
+func TestExpireIdleRechecksRequests(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	h := newTestHandler(app, "192.168.1.50")
+	if _, err := h.handleDomain(ctx, "app.example.com", ""); err != nil {
+		t.Fatalf("handleDomain: %v", err)
+	}
+	app.mu.Lock()
+	for _, record := range app.managed {
+		record.LastSeen = time.Now().Add(-time.Hour)
+	}
+	app.mu.Unlock()
+
+	// A request arrives while the sweep waits for the domain
+	unlock := app.lockDomain("app.example.com")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.expireIdle(time.Minute)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	app.domainsRequested([]string{"app.example.com"})
+	unlock()
+	<-done
+
+	if got := recordValues(t, app.clients["memory"], "app.example.com", "A"); len(got) != 1 {
+		t.Errorf("expected the requested record to be kept, got %v", got)
+	}
+}
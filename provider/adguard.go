@@ -0,0 +1,272 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AdGuardProvider implements DNSService for AdGuard Home DNS rewrites
+type AdGuardProvider struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+	logger   *zap.Logger
+	debug    bool
+}
+
+// adguardRewrite is an entry of /control/rewrite/list
+type adguardRewrite struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+}
+
+// NewAdGuardProvider creates a new AdGuard Home provider
+func NewAdGuardProvider(hostname, username, password string, ttl int, timeout time.Duration, tlsConfig *tls.Config, logger *zap.Logger, debug bool) (*AdGuardProvider, error) {
+	if hostname == "" || username == "" || password == "" {
+		return nil, errors.New("adguard provider requires hostname, api_key (username), and api_secret (password)")
+	}
+
+	// Rewrites are answered with AdGuard's blocked response TTL
+	if ttl > 0 {
+		logger.Warn("ttl is not supported by AdGuard Home rewrites and will be ignored", zap.String("hostname", hostname))
+	}
+
+	// AdGuard Home serves plain HTTP by default, allow an explicit scheme in hostname
+	baseURL := hostname
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	// A nil tlsConfig keeps the default verification
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+	}
+
+	if debug {
+		logger.Debug("AdGuard provider created",
+			zap.String("base_url", baseURL),
+			zap.Duration("timeout", timeout),
+			zap.Bool("custom_tls", tlsConfig != nil))
+	}
+
+	return &AdGuardProvider{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		client:   client,
+		logger:   logger,
+		debug:    debug,
+	}, nil
+}
+
+func (p *AdGuardProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if !strings.Contains(domain, ".") {
+		return fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+	if recordType != "A" && recordType != "AAAA" && recordType != "CNAME" {
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "AdGuard Home"}
+	}
+
+	if p.debug {
+		p.logger.Debug("creating AdGuard rewrite",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	if _, err := p.apiCall(ctx, "POST", "rewrite/add", adguardRewrite{Domain: domain, Answer: value}); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("AdGuard rewrite created successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *AdGuardProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("updating AdGuard rewrite", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	// AdGuard Home has no in-place update, rewrites are keyed by domain and answer
+	if err := p.DeleteRecord(ctx, domain, recordType); err != nil {
+		return err
+	}
+	return p.CreateRecord(ctx, domain, recordType, value)
+}
+
+func (p *AdGuardProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting AdGuard rewrite", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		if p.debug {
+			p.logger.Debug("record not found, nothing to delete", zap.String("domain", domain))
+		}
+		return nil // Already deleted
+	}
+
+	for _, record := range existing {
+		if _, err := p.apiCall(ctx, "POST", "rewrite/delete", adguardRewrite{Domain: domain, Answer: record.Value}); err != nil {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("AdGuard rewrite deleted successfully", zap.String("domain", domain), zap.Int("count", len(existing)))
+	}
+	return nil
+}
+
+func (p *AdGuardProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if !strings.Contains(domain, ".") {
+		return nil, fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+
+	if p.debug {
+		p.logger.Debug("searching AdGuard rewrites", zap.String("domain", domain))
+	}
+
+	resp, err := p.apiCall(ctx, "GET", "rewrite/list", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rewrites []adguardRewrite
+	if err := json.Unmarshal(resp, &rewrites); err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("found AdGuard rewrites", zap.Int("count", len(rewrites)))
+	}
+
+	var records []*DNSRecord
+	for _, rewrite := range rewrites {
+		if !strings.EqualFold(rewrite.Domain, domain) {
+			continue
+		}
+
+		// The answer is an IP or a host name, "A" and "AAAA" keep the upstream answer
+		var recordType string
+		switch {
+		case rewrite.Answer == "A" || rewrite.Answer == "AAAA":
+			continue
+		case net.ParseIP(rewrite.Answer) != nil:
+			recordType = RecordTypeForIP(rewrite.Answer)
+		default:
+			recordType = "CNAME"
+		}
+
+		if p.debug {
+			p.logger.Debug("found matching AdGuard rewrite",
+				zap.String("domain", domain),
+				zap.String("record_type", recordType),
+				zap.String("value", rewrite.Answer))
+		}
+		records = append(records, &DNSRecord{
+			Domain:     domain,
+			Value:      rewrite.Answer,
+			RecordType: recordType,
+			Enabled:    true,
+		})
+	}
+
+	if p.debug && len(records) == 0 {
+		p.logger.Debug("no matching AdGuard rewrite found", zap.String("domain", domain))
+	}
+	return records, nil
+}
+
+func (p *AdGuardProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating AdGuard connectivity", zap.String("base_url", p.baseURL))
+	}
+
+	_, err := p.apiCall(ctx, "GET", "rewrite/list", nil)
+	return err
+}
+
+func (p *AdGuardProvider) apiCall(ctx context.Context, method, endpoint string, payload any) ([]byte, error) {
+	apiURL := fmt.Sprintf("%s/control/%s", p.baseURL, endpoint)
+
+	if p.debug {
+		p.logger.Debug("making API call",
+			zap.String("method", method),
+			zap.String("url", apiURL),
+			zap.Any("payload", payload))
+	}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(p.username, p.password)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.debug {
+			p.logger.Debug("API call failed", zap.Error(err))
+		}
+		if strings.Contains(err.Error(), "certificate") || strings.Contains(err.Error(), "tls") {
+			return nil, fmt.Errorf("SSL/TLS error connecting to AdGuard Home API. If using self-signed certificates, set 'ca_cert' or enable 'insecure' option: %w", err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("API call response",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(out)))
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, string(out))
+	}
+	return out, nil
+}
+
+// Interface compliance
+var _ DNSService = (*AdGuardProvider)(nil)
@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrNotConfirmed is returned when a change wasn't confirmed in time. The
+// change itself succeeded, so it isn't retried.
+var ErrNotConfirmed = errors.New("change not confirmed")
+
+// AwaitService wraps a DNSService and, after each created or updated record,
+// polls FindRecord until the record is present. Providers like OPNsense apply
+// changes asynchronously, this makes callers wait until they're live.
+type AwaitService struct {
+	inner    DNSService
+	timeout  time.Duration
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+// NewAwaitService wraps inner so changes wait up to timeout for the record,
+// which is looked up every interval
+func NewAwaitService(inner DNSService, timeout, interval time.Duration, logger *zap.Logger) *AwaitService {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &AwaitService{
+		inner:    inner,
+		timeout:  timeout,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+func (s *AwaitService) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := s.inner.CreateRecord(ctx, domain, recordType, value); err != nil {
+		return err
+	}
+	return s.await(ctx, domain, recordType, value)
+}
+
+func (s *AwaitService) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	return s.inner.DeleteRecord(ctx, domain, recordType)
+}
+
+func (s *AwaitService) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := s.inner.UpdateRecord(ctx, domain, recordType, value); err != nil {
+		return err
+	}
+	return s.await(ctx, domain, recordType, value)
+}
+
+func (s *AwaitService) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	return SetEnabled(ctx, s.inner, domain, recordType, enabled)
+}
+
+func (s *AwaitService) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	return s.inner.FindRecord(ctx, domain)
+}
+
+func (s *AwaitService) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	return ListRecords(ctx, s.inner)
+}
+
+func (s *AwaitService) Validate(ctx context.Context) error {
+	return s.inner.Validate(ctx)
+}
+
+// await polls until domain has a record of recordType with value
+func (s *AwaitService) await(ctx context.Context, domain, recordType, value string) error {
+	deadline := time.NewTimer(s.timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		records, err := s.inner.FindRecord(ctx, domain)
+		if err == nil && hasRecord(records, recordType, value) {
+			return nil
+		}
+		if err != nil {
+			s.logger.Warn("failed to confirm record change, trying again",
+				zap.String("domain", domain),
+				zap.String("record_type", recordType),
+				zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			if err != nil {
+				return fmt.Errorf("%w: %s record for %s: %w", ErrNotConfirmed, recordType, domain, err)
+			}
+			return fmt.Errorf("%w: %s record for %s not found within %s", ErrNotConfirmed, recordType, domain, s.timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// hasRecord reports whether records contain an enabled record of recordType
+// with value. Addresses and host names are compared in canonical form.
+func hasRecord(records []*DNSRecord, recordType, value string) bool {
+	for _, record := range filterRecords(records, recordType) {
+		if !record.Enabled {
+			continue
+		}
+		if a, b := net.ParseIP(record.Value), net.ParseIP(value); a != nil && b != nil {
+			if a.Equal(b) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(strings.TrimSuffix(record.Value, "."), strings.TrimSuffix(value, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*AwaitService)(nil)
+	_ Toggler    = (*AwaitService)(nil)
+	_ Lister     = (*AwaitService)(nil)
+)
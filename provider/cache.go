@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CachedService wraps a DNSService and caches FindRecord results per domain
+type CachedService struct {
+	inner DNSService
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	swept   time.Time // last removal of expired entries
+}
+
+type cacheEntry struct {
+	records []*DNSRecord
+	expires time.Time
+}
+
+// NewCachedService wraps inner so FindRecord results are reused for ttl.
+// Any change made through the wrapper invalidates the domain's entry.
+func NewCachedService(inner DNSService, ttl time.Duration) *CachedService {
+	return &CachedService{
+		inner:   inner,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *CachedService) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	// Invalidate even on failure, the provider state is unknown then
+	defer c.invalidate(domain)
+	return c.inner.CreateRecord(ctx, domain, recordType, value)
+}
+
+func (c *CachedService) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	defer c.invalidate(domain)
+	return c.inner.DeleteRecord(ctx, domain, recordType)
+}
+
+func (c *CachedService) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	defer c.invalidate(domain)
+	return c.inner.UpdateRecord(ctx, domain, recordType, value)
+}
+
+func (c *CachedService) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	defer c.invalidate(domain)
+	return SetEnabled(ctx, c.inner, domain, recordType, enabled)
+}
+
+func (c *CachedService) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[domain]
+	if ok && !time.Now().Before(entry.expires) {
+		delete(c.entries, domain)
+		ok = false
+	}
+	c.mu.Unlock()
+	if bypass, _ := ctx.Value(uncachedKey{}).(bool); ok && !bypass {
+		return entry.records, nil
+	}
+
+	records, err := c.inner.FindRecord(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	c.entries[domain] = cacheEntry{records: records, expires: now.Add(c.ttl)}
+	// Domains that are never looked up again would stay forever otherwise
+	if now.Sub(c.swept) >= c.ttl {
+		c.sweep(now)
+	}
+	c.mu.Unlock()
+	return records, nil
+}
+
+// sweep removes the expired entries, c.mu must be held
+func (c *CachedService) sweep(now time.Time) {
+	for domain, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, domain)
+		}
+	}
+	c.swept = now
+}
+
+func (c *CachedService) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	return ListRecords(ctx, c.inner)
+}
+
+func (c *CachedService) Validate(ctx context.Context) error {
+	return c.inner.Validate(ctx)
+}
+
+func (c *CachedService) invalidate(domain string) {
+	c.mu.Lock()
+	delete(c.entries, domain)
+	c.mu.Unlock()
+}
+
+type uncachedKey struct{}
+
+// WithoutCache returns a context in which FindRecord asks the provider even
+// for cached domains, e.g. to see changes made on the DNS server. The
+// result is cached again.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncachedKey{}, true)
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*CachedService)(nil)
+	_ Toggler    = (*CachedService)(nil)
+	_ Lister     = (*CachedService)(nil)
+)
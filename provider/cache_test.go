@@ -0,0 +1,31 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestCachedServiceEvictsExpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCachedService(NewMemoryProvider(zap.NewNop(), false), 10*time.Millisecond)
+
+	for _, domain := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		if _, err := cache.FindRecord(ctx, domain); err != nil {
+			t.Fatalf("FindRecord(%s): %v", domain, err)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := cache.FindRecord(ctx, "d.example.com"); err != nil {
+		t.Fatalf("FindRecord: %v", err)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if len(cache.entries) != 1 {
+		t.Errorf("expected only the fresh entry to be cached, got %d entries", len(cache.entries))
+	}
+}
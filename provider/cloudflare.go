@@ -0,0 +1,372 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cloudflareAPI is the base URL of the Cloudflare v4 API
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// CloudflareProvider implements DNSService for a Cloudflare zone
+type CloudflareProvider struct {
+	token   string
+	zoneID  string
+	ttl     int
+	proxied bool
+	client  *http.Client
+	logger  *zap.Logger
+	debug   bool
+}
+
+// cloudflareRecord is a DNS record as used by the dns_records API
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// NewCloudflareProvider creates a new Cloudflare provider for the zone with
+// zoneID. proxied routes created records through Cloudflare instead of
+// serving them DNS-only.
+func NewCloudflareProvider(token, zoneID string, ttl int, proxied bool, timeout time.Duration, logger *zap.Logger, debug bool) (*CloudflareProvider, error) {
+	if token == "" || zoneID == "" {
+		return nil, errors.New("cloudflare provider requires api_key and zone_id")
+	}
+
+	// A TTL of 1 means automatic
+	if ttl <= 0 {
+		ttl = 1
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout: timeout,
+	}
+
+	if debug {
+		logger.Debug("Cloudflare provider created",
+			zap.String("zone_id", zoneID),
+			zap.Int("ttl", ttl),
+			zap.Bool("proxied", proxied),
+			zap.Duration("timeout", timeout))
+	}
+
+	return &CloudflareProvider{
+		token:   token,
+		zoneID:  zoneID,
+		ttl:     ttl,
+		proxied: proxied,
+		client:  client,
+		logger:  logger,
+		debug:   debug,
+	}, nil
+}
+
+func (p *CloudflareProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if !strings.Contains(domain, ".") {
+		return fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+	if err := checkCloudflareType(recordType); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("creating Cloudflare record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	resp, err := p.apiCall(ctx, "POST", "dns_records", p.newRecord(ctx, domain, recordType, value))
+	if err != nil {
+		return err
+	}
+	var created cloudflareRecord
+	if err := json.Unmarshal(resp, &created); err == nil {
+		setRecordID(ctx, created.ID)
+	}
+
+	if p.debug {
+		p.logger.Debug("Cloudflare record created successfully", zap.String("domain", domain), zap.String("id", created.ID))
+	}
+	return nil
+}
+
+func (p *CloudflareProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("updating Cloudflare record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	if err := checkCloudflareType(recordType); err != nil {
+		return err
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		p.logger.Info("record not found during update, creating new one", zap.String("domain", domain))
+		return p.CreateRecord(ctx, domain, recordType, value)
+	}
+
+	// Overwrite the first record and drop any duplicates
+	if _, err := p.apiCall(ctx, "PUT", "dns_records/"+existing[0].UUID, p.newRecord(ctx, domain, recordType, value)); err != nil {
+		return err
+	}
+	for _, record := range existing[1:] {
+		if _, err := p.apiCall(ctx, "DELETE", "dns_records/"+record.UUID, nil); err != nil {
+			return err
+		}
+	}
+	setRecordID(ctx, existing[0].UUID)
+
+	if p.debug {
+		p.logger.Debug("Cloudflare record updated successfully", zap.String("domain", domain), zap.String("id", existing[0].UUID))
+	}
+	return nil
+}
+
+func (p *CloudflareProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting Cloudflare record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		if p.debug {
+			p.logger.Debug("record not found, nothing to delete", zap.String("domain", domain))
+		}
+		return nil // Already deleted
+	}
+
+	for _, record := range existing {
+		if _, err := p.apiCall(ctx, "DELETE", "dns_records/"+record.UUID, nil); err != nil {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("Cloudflare record deleted successfully", zap.String("domain", domain), zap.Int("count", len(existing)))
+	}
+	return nil
+}
+
+func (p *CloudflareProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if !strings.Contains(domain, ".") {
+		return nil, fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+
+	if p.debug {
+		p.logger.Debug("searching Cloudflare records", zap.String("domain", domain))
+	}
+
+	query := url.Values{"name": {domain}, "per_page": {"100"}}
+	resp, err := p.apiCall(ctx, "GET", "dns_records?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []cloudflareRecord
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, row := range rows {
+		if !strings.EqualFold(row.Name, domain) || checkCloudflareType(row.Type) != nil {
+			continue
+		}
+
+		if p.debug {
+			p.logger.Debug("found matching Cloudflare record",
+				zap.String("domain", domain),
+				zap.String("id", row.ID),
+				zap.String("record_type", row.Type),
+				zap.String("value", row.Content),
+				zap.Bool("proxied", row.Proxied))
+		}
+		records = append(records, &DNSRecord{
+			Domain:      domain,
+			Value:       row.Content,
+			RecordType:  row.Type,
+			UUID:        row.ID,
+			Enabled:     true,
+			Description: row.Comment,
+		})
+	}
+
+	if p.debug && len(records) == 0 {
+		p.logger.Debug("no matching Cloudflare record found", zap.String("domain", domain))
+	}
+	return records, nil
+}
+
+// ListRecords returns the records of the zone commented by this plugin
+func (p *CloudflareProvider) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	if p.debug {
+		p.logger.Debug("listing managed Cloudflare records", zap.String("zone_id", p.zoneID))
+	}
+
+	query := url.Values{"comment.startswith": {managedDescription}, "per_page": {"5000"}}
+	resp, err := p.apiCall(ctx, "GET", "dns_records?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []cloudflareRecord
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, row := range rows {
+		if !isManaged(row.Comment, managedDescription) || checkCloudflareType(row.Type) != nil {
+			continue
+		}
+		records = append(records, &DNSRecord{
+			Domain:      row.Name,
+			Value:       row.Content,
+			RecordType:  row.Type,
+			UUID:        row.ID,
+			Enabled:     true,
+			Description: row.Comment,
+		})
+	}
+
+	if p.debug {
+		p.logger.Debug("found managed Cloudflare records", zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *CloudflareProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating Cloudflare zone access", zap.String("zone_id", p.zoneID))
+	}
+
+	_, err := p.apiCall(ctx, "GET", "", nil)
+	return err
+}
+
+// newRecord returns the payload creating or replacing a record
+func (p *CloudflareProvider) newRecord(ctx context.Context, domain, recordType, value string) cloudflareRecord {
+	return cloudflareRecord{
+		Type:    recordType,
+		Name:    domain,
+		Content: value,
+		TTL:     p.ttl,
+		Proxied: p.proxied,
+		Comment: recordDescription(ctx, managedDescription),
+	}
+}
+
+// checkCloudflareType rejects record types the provider doesn't manage
+func checkCloudflareType(recordType string) error {
+	switch recordType {
+	case "A", "AAAA", "CNAME":
+		return nil
+	default:
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "the Cloudflare provider"}
+	}
+}
+
+// apiCall sends a request below the zone's endpoint and returns the
+// "result" of a successful response
+func (p *CloudflareProvider) apiCall(ctx context.Context, method, endpoint string, payload any) ([]byte, error) {
+	apiURL := fmt.Sprintf("%s/zones/%s", cloudflareAPI, url.PathEscape(p.zoneID))
+	if endpoint != "" {
+		apiURL += "/" + endpoint
+	}
+
+	if p.debug {
+		p.logger.Debug("making API call",
+			zap.String("method", method),
+			zap.String("url", apiURL),
+			zap.Any("payload", payload))
+	}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.debug {
+			p.logger.Debug("API call failed", zap.Error(err))
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("API call response",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(out)))
+	}
+
+	var res struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, string(out))
+	}
+	if !res.Success {
+		var messages []string
+		for _, e := range res.Errors {
+			messages = append(messages, fmt.Sprintf("%d: %s", e.Code, e.Message))
+		}
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, strings.Join(messages, "; "))
+	}
+	return res.Result, nil
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*CloudflareProvider)(nil)
+	_ Lister     = (*CloudflareProvider)(nil)
+)
@@ -0,0 +1,450 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// coreDNSEtcdLeaf prefixes the keys of the records created by the provider,
+// keys of the same name without it belong to subdomains
+const coreDNSEtcdLeaf = "local-dns-"
+
+// CoreDNSEtcdProvider implements DNSService for CoreDNS with the etcd
+// plugin. Records are SkyDNS messages below prefix, e.g. app.example.com
+// lives at /skydns/com/example/app. The provider talks to the JSON gateway
+// of the etcd v3 API, trying the endpoints in order. The gateway is enabled
+// by default since etcd 3.4 and must not be disabled with
+// --enable-grpc-gateway=false. It keeps the etcd client and gRPC out of
+// Caddy builds.
+type CoreDNSEtcdProvider struct {
+	endpoints []string
+	prefix    string
+	username  string
+	password  string
+	ttl       int
+	client    *http.Client
+	logger    *zap.Logger
+	debug     bool
+
+	mu      sync.Mutex
+	current int    // index of the endpoint that answered last
+	token   string // of the authenticated user, empty until needed
+}
+
+// coreDNSService is the SkyDNS message CoreDNS reads from etcd
+type coreDNSService struct {
+	Host string `json:"host,omitempty"`
+	TTL  uint32 `json:"ttl,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+// etcdKeyValue is an entry of an etcd range response, key and value are
+// base64-encoded
+type etcdKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// NewCoreDNSEtcdProvider creates a new CoreDNS etcd provider. Endpoints
+// without a scheme use HTTPS when TLS is configured. prefix defaults to
+// "/skydns", the plugin's default path. username and password enable etcd
+// authentication, clientCert and clientKey a client certificate.
+func NewCoreDNSEtcdProvider(endpoints []string, prefix, username, password, clientCert, clientKey string, ttl int, timeout time.Duration, tlsConfig *tls.Config, logger *zap.Logger, debug bool) (*CoreDNSEtcdProvider, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("coredns-etcd provider requires endpoints")
+	}
+	if (clientCert == "") != (clientKey == "") {
+		return nil, errors.New("coredns-etcd provider requires both client_cert and client_key")
+	}
+
+	if clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	scheme := "http://"
+	if tlsConfig != nil {
+		scheme = "https://"
+	}
+	urls := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if !strings.Contains(endpoint, "://") {
+			endpoint = scheme + endpoint
+		}
+		urls = append(urls, strings.TrimRight(endpoint, "/"))
+	}
+
+	if prefix == "" {
+		prefix = "/skydns"
+	}
+	prefix = "/" + strings.Trim(prefix, "/")
+
+	// A nil tlsConfig keeps the default verification
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+	}
+
+	if debug {
+		logger.Debug("CoreDNS etcd provider created",
+			zap.Strings("endpoints", urls),
+			zap.String("prefix", prefix),
+			zap.Bool("auth", username != ""),
+			zap.Bool("client_cert", clientCert != ""),
+			zap.Int("ttl", ttl),
+			zap.Duration("timeout", timeout))
+	}
+
+	return &CoreDNSEtcdProvider{
+		endpoints: urls,
+		prefix:    prefix,
+		username:  username,
+		password:  password,
+		ttl:       ttl,
+		client:    client,
+		logger:    logger,
+		debug:     debug,
+	}, nil
+}
+
+func (p *CoreDNSEtcdProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	service, err := p.newService(domain, recordType, value)
+	if err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("creating CoreDNS etcd record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	data, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	key := p.recordKey(domain, recordType, value)
+	if _, err := p.apiCall(ctx, "kv/put", map[string]string{"key": encodeEtcd(key), "value": encodeEtcd(string(data))}); err != nil {
+		return err
+	}
+	setRecordID(ctx, key)
+
+	if p.debug {
+		p.logger.Debug("CoreDNS etcd record created successfully", zap.String("domain", domain), zap.String("key", key))
+	}
+	return nil
+}
+
+func (p *CoreDNSEtcdProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if _, err := p.newService(domain, recordType, value); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("updating CoreDNS etcd record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	// The key depends on the value, so the record is replaced
+	if err := p.DeleteRecord(ctx, domain, recordType); err != nil {
+		return err
+	}
+	return p.CreateRecord(ctx, domain, recordType, value)
+}
+
+func (p *CoreDNSEtcdProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting CoreDNS etcd record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		if p.debug {
+			p.logger.Debug("record not found, nothing to delete", zap.String("domain", domain))
+		}
+		return nil // Already deleted
+	}
+
+	for _, record := range existing {
+		if _, err := p.apiCall(ctx, "kv/deleterange", map[string]string{"key": encodeEtcd(record.UUID)}); err != nil {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("CoreDNS etcd record deleted successfully", zap.String("domain", domain), zap.Int("count", len(existing)))
+	}
+	return nil
+}
+
+func (p *CoreDNSEtcdProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if p.debug {
+		p.logger.Debug("searching CoreDNS etcd records", zap.String("domain", domain))
+	}
+
+	// The range up to "<path>0" covers the key of the name and the keys
+	// below it ('/' + 1), others are filtered
+	path := p.domainPath(domain)
+	resp, err := p.apiCall(ctx, "kv/range", map[string]string{"key": encodeEtcd(path), "range_end": encodeEtcd(path + "0")})
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	if err := json.Unmarshal(resp, &res); err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, kv := range res.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			continue
+		}
+		if string(key) != path && !strings.HasPrefix(string(key), path+"/"+coreDNSEtcdLeaf) {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			continue
+		}
+		var service coreDNSService
+		if err := json.Unmarshal(value, &service); err != nil {
+			if p.debug {
+				p.logger.Debug("skipping invalid SkyDNS message", zap.String("key", string(key)), zap.Error(err))
+			}
+			continue
+		}
+
+		record := &DNSRecord{Domain: domain, UUID: string(key), Enabled: true}
+		switch {
+		case service.Host == "" && service.Text != "":
+			record.RecordType = "TXT"
+			record.Value = service.Text
+		case net.ParseIP(service.Host) != nil:
+			record.RecordType = RecordTypeForIP(service.Host)
+			record.Value = service.Host
+		case service.Host != "":
+			record.RecordType = "CNAME"
+			record.Value = service.Host
+		default:
+			continue
+		}
+		records = append(records, record)
+	}
+
+	if p.debug {
+		p.logger.Debug("found CoreDNS etcd records", zap.String("domain", domain), zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *CoreDNSEtcdProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating etcd access", zap.String("prefix", p.prefix))
+	}
+
+	_, err := p.apiCall(ctx, "kv/range", map[string]any{"key": encodeEtcd(p.prefix), "keys_only": true})
+	return err
+}
+
+// newService returns the SkyDNS message of a record
+func (p *CoreDNSEtcdProvider) newService(domain, recordType, value string) (coreDNSService, error) {
+	service := coreDNSService{}
+	if p.ttl > 0 {
+		service.TTL = uint32(p.ttl)
+	}
+
+	switch recordType {
+	case "A", "AAAA":
+		if RecordTypeForIP(value) != recordType || net.ParseIP(value) == nil {
+			return service, fmt.Errorf("invalid %s record value for %s: %q", recordType, domain, value)
+		}
+		service.Host = value
+	case "CNAME":
+		service.Host = strings.TrimSuffix(value, ".")
+	case "TXT":
+		service.Text = value
+	default:
+		return service, ErrUnsupportedRecordType{RecordType: recordType, Backend: "the CoreDNS etcd provider"}
+	}
+	return service, nil
+}
+
+// domainPath returns the key of domain, its labels reversed below the prefix
+func (p *CoreDNSEtcdProvider) domainPath(domain string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return p.prefix + "/" + strings.Join(labels, "/")
+}
+
+// recordKey returns the key of a record created by the provider. Each
+// value gets its own key, so a name can have several records.
+func (p *CoreDNSEtcdProvider) recordKey(domain, recordType, value string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(value))
+	return fmt.Sprintf("%s/%s%s-%08x", p.domainPath(domain), coreDNSEtcdLeaf, strings.ToLower(recordType), hash.Sum32())
+}
+
+// encodeEtcd encodes keys and values for the JSON gateway
+func encodeEtcd(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// authenticate returns a token of the user, requesting one if needed
+func (p *CoreDNSEtcdProvider) authenticate(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" {
+		return p.token, nil
+	}
+
+	if p.debug {
+		p.logger.Debug("authenticating with etcd", zap.String("username", p.username))
+	}
+	out, status, err := p.send(ctx, "auth/authenticate", map[string]string{"name": p.username, "password": p.password}, "")
+	if err != nil {
+		return "", err
+	}
+	if status >= 400 {
+		return "", fmt.Errorf("authentication failed: %w", statusError(status, out))
+	}
+
+	var res struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		return "", err
+	}
+	p.token = res.Token
+	return p.token, nil
+}
+
+// apiCall sends a request to the v3 API and returns the response body.
+// Tokens are requested on demand and renewed once when rejected.
+func (p *CoreDNSEtcdProvider) apiCall(ctx context.Context, endpoint string, payload any) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		var token string
+		if p.username != "" {
+			var err error
+			if token, err = p.authenticate(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		out, status, err := p.send(ctx, endpoint, payload, token)
+		if err != nil {
+			return nil, err
+		}
+		if status == http.StatusUnauthorized && token != "" && attempt == 0 {
+			// The token expired, request a new one
+			p.mu.Lock()
+			p.token = ""
+			p.mu.Unlock()
+			continue
+		}
+		if status >= 400 {
+			return nil, statusError(status, out)
+		}
+		return out, nil
+	}
+}
+
+// send makes a single request, trying the endpoints in order starting with
+// the last one that answered, and returns the response body and status
+func (p *CoreDNSEtcdProvider) send(ctx context.Context, endpoint string, payload any, token string) ([]byte, int, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	p.mu.Lock()
+	start := p.current
+	p.mu.Unlock()
+
+	var errs []error
+	for i := range p.endpoints {
+		index := (start + i) % len(p.endpoints)
+		apiURL := p.endpoints[index] + "/v3/" + endpoint
+
+		if p.debug {
+			p.logger.Debug("making API call",
+				zap.String("url", apiURL),
+				zap.Any("payload", payload))
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			if p.debug {
+				p.logger.Debug("API call failed", zap.String("url", apiURL), zap.Error(err))
+			}
+			if ctx.Err() != nil {
+				return nil, 0, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		out, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if p.debug {
+			p.logger.Debug("API call response",
+				zap.Int("status_code", resp.StatusCode),
+				zap.String("response", string(out)))
+		}
+
+		p.mu.Lock()
+		p.current = index
+		p.mu.Unlock()
+		return out, resp.StatusCode, nil
+	}
+	return nil, 0, fmt.Errorf("%w: no etcd endpoint reachable: %w", ErrUnavailable, errors.Join(errs...))
+}
+
+// Interface compliance
+var _ DNSService = (*CoreDNSEtcdProvider)(nil)
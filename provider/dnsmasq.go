@@ -0,0 +1,376 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DnsmasqProvider implements DNSService for a standalone dnsmasq reached over SSH.
+// Records live in an addn-hosts file which is rewritten atomically, dnsmasq is
+// reloaded with SIGHUP afterwards.
+type DnsmasqProvider struct {
+	address   string
+	hostsFile string
+	config    *ssh.ClientConfig
+	logger    *zap.Logger
+	debug     bool
+
+	// serializes read-modify-write cycles of the hosts file
+	mu sync.Mutex
+}
+
+// NewDnsmasqProvider creates a new dnsmasq provider. hostname is the SSH host
+// (port 22 unless given), keyFile the private key used to authenticate as user.
+// knownHostsFile defaults to ~/.ssh/known_hosts and is ignored when insecure is set.
+// timeout bounds establishing the SSH connection.
+func NewDnsmasqProvider(hostname, user, keyFile, hostsFile, knownHostsFile string, timeout time.Duration, insecure bool, logger *zap.Logger, debug bool) (*DnsmasqProvider, error) {
+	if hostname == "" || user == "" || keyFile == "" {
+		return nil, errors.New("dnsmasq provider requires hostname, ssh_user, and ssh_key")
+	}
+
+	if hostsFile == "" {
+		hostsFile = "/etc/dnsmasq.d/caddy-local-dns.hosts"
+	}
+
+	address := hostname
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh_key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh_key: %w", err)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if insecure {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+		if debug {
+			logger.Debug("dnsmasq provider configured without host key verification", zap.String("hostname", hostname))
+		}
+	} else {
+		if knownHostsFile == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to locate known_hosts: %w", err)
+			}
+			knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		hostKeyCallback, err = knownhosts.New(knownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts (enable 'insecure' to skip host key verification): %w", err)
+		}
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	if debug {
+		logger.Debug("dnsmasq provider created",
+			zap.String("address", address),
+			zap.String("user", user),
+			zap.String("hosts_file", hostsFile),
+			zap.Bool("insecure", insecure))
+	}
+
+	return &DnsmasqProvider{
+		address:   address,
+		hostsFile: hostsFile,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         timeout,
+		},
+		logger: logger,
+		debug:  debug,
+	}, nil
+}
+
+func (p *DnsmasqProvider) CreateRecord(ctx context.Context, domain, recordType, ip string) error {
+	if !strings.Contains(domain, ".") {
+		return fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+	if IsWildcard(domain) {
+		return fmt.Errorf("wildcard records are not supported by hosts files: %s", domain)
+	}
+	if recordType != "A" && recordType != "AAAA" {
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "hosts files"}
+	}
+
+	if p.debug {
+		p.logger.Debug("creating dnsmasq record",
+			zap.String("domain", domain),
+			zap.String("ip", ip))
+	}
+
+	return p.modify(ctx, func(lines []string) []string {
+		return append(lines, fmt.Sprintf("%s %s # %s", ip, domain, recordDescription(ctx, managedDescription)))
+	})
+}
+
+func (p *DnsmasqProvider) UpdateRecord(ctx context.Context, domain, recordType, ip string) error {
+	if recordType != "A" && recordType != "AAAA" {
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "hosts files"}
+	}
+
+	if p.debug {
+		p.logger.Debug("updating dnsmasq record", zap.String("domain", domain), zap.String("ip", ip))
+	}
+
+	// Replace all entries of the same family in a single rewrite
+	return p.modify(ctx, func(lines []string) []string {
+		lines = removeHostsEntries(lines, domain, recordType)
+		return append(lines, fmt.Sprintf("%s %s # %s", ip, domain, recordDescription(ctx, managedDescription)))
+	})
+}
+
+func (p *DnsmasqProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting dnsmasq record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	return p.modify(ctx, func(lines []string) []string {
+		return removeHostsEntries(lines, domain, recordType)
+	})
+}
+
+func (p *DnsmasqProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if !strings.Contains(domain, ".") {
+		return nil, fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+
+	if p.debug {
+		p.logger.Debug("searching dnsmasq records", zap.String("domain", domain))
+	}
+
+	lines, err := p.readHostsFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, line := range lines {
+		ip, names, comment := parseHostsLine(line)
+		for _, name := range names {
+			if !strings.EqualFold(name, domain) {
+				continue
+			}
+			records = append(records, &DNSRecord{
+				Domain:      domain,
+				Value:       ip,
+				RecordType:  RecordTypeForIP(ip),
+				Enabled:     true, // commented out entries are not parsed
+				Description: comment,
+			})
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("found dnsmasq records", zap.String("domain", domain), zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+// ListRecords returns the hosts file entries commented by this plugin
+func (p *DnsmasqProvider) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	lines, err := p.readHostsFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, line := range lines {
+		ip, names, comment := parseHostsLine(line)
+		if !isManaged(comment, managedDescription) {
+			continue
+		}
+		for _, name := range names {
+			records = append(records, &DNSRecord{
+				Domain:      name,
+				Value:       ip,
+				RecordType:  RecordTypeForIP(ip),
+				Enabled:     true,
+				Description: comment,
+			})
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("found managed dnsmasq records", zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *DnsmasqProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating dnsmasq connectivity", zap.String("address", p.address))
+	}
+
+	_, err := p.readHostsFile(ctx)
+	return err
+}
+
+// modify applies change to the hosts file, writes it back atomically and reloads dnsmasq
+func (p *DnsmasqProvider) modify(ctx context.Context, change func(lines []string) []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lines, err := p.readHostsFile(ctx)
+	if err != nil {
+		return err
+	}
+	lines = change(lines)
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	// Write to a temporary file and rename it, so dnsmasq never reads a partial file
+	file := shellQuote(p.hostsFile)
+	tmp := shellQuote(p.hostsFile + ".tmp")
+	cmd := fmt.Sprintf("cat > %s && mv %s %s && pkill -HUP -x dnsmasq", tmp, tmp, file)
+	if _, err := p.run(ctx, cmd, &buf); err != nil {
+		return fmt.Errorf("failed to write hosts file: %w", err)
+	}
+
+	if p.debug {
+		p.logger.Debug("dnsmasq hosts file written and reloaded",
+			zap.String("hosts_file", p.hostsFile),
+			zap.Int("lines", len(lines)))
+	}
+	return nil
+}
+
+// readHostsFile returns the lines of the hosts file, a missing file has no lines
+func (p *DnsmasqProvider) readHostsFile(ctx context.Context) ([]string, error) {
+	file := shellQuote(p.hostsFile)
+	out, err := p.run(ctx, fmt.Sprintf("if [ -e %s ]; then cat %s; fi", file, file), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hosts file: %w", err)
+	}
+
+	content := strings.TrimRight(string(out), "\n")
+	if content == "" {
+		return nil, nil
+	}
+	return strings.Split(content, "\n"), nil
+}
+
+// run executes cmd on the remote host, feeding it stdin if given
+func (p *DnsmasqProvider) run(ctx context.Context, cmd string, stdin *bytes.Buffer) ([]byte, error) {
+	if p.debug {
+		p.logger.Debug("running SSH command",
+			zap.String("address", p.address),
+			zap.String("command", cmd))
+	}
+
+	dialer := net.Dialer{Timeout: p.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return nil, err
+	}
+	// Closing the connection aborts the handshake or a running command
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, p.address, p.config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if stdin != nil {
+		session.Stdin = stdin
+	}
+
+	if err := session.Run(cmd); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseHostsLine splits a hosts file line into address, names and comment
+func parseHostsLine(line string) (string, []string, string) {
+	content, comment, _ := strings.Cut(line, "#")
+	fields := strings.Fields(content)
+	if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+		return "", nil, ""
+	}
+	return fields[0], fields[1:], strings.TrimSpace(comment)
+}
+
+// removeHostsEntries drops domain from all lines with an address of recordType.
+// Lines left without names are removed, unrelated lines are kept as they are.
+func removeHostsEntries(lines []string, domain, recordType string) []string {
+	var out []string
+	for _, line := range lines {
+		ip, names, comment := parseHostsLine(line)
+		if ip == "" || RecordTypeForIP(ip) != recordType {
+			out = append(out, line)
+			continue
+		}
+
+		var kept []string
+		for _, name := range names {
+			if !strings.EqualFold(name, domain) {
+				kept = append(kept, name)
+			}
+		}
+		switch {
+		case len(kept) == len(names):
+			out = append(out, line)
+		case len(kept) > 0:
+			rebuilt := ip + " " + strings.Join(kept, " ")
+			if comment != "" {
+				rebuilt += " # " + comment
+			}
+			out = append(out, rebuilt)
+		}
+	}
+	return out
+}
+
+// shellQuote quotes s for use as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*DnsmasqProvider)(nil)
+	_ Lister     = (*DnsmasqProvider)(nil)
+)
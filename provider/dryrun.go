@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// DryRunService wraps a DNSService and only logs changes instead of applying
+// them. Lookups and validation still reach the provider.
+type DryRunService struct {
+	inner  DNSService
+	name   string
+	logger *zap.Logger
+}
+
+// NewDryRunService wraps inner, name identifies the provider in the logs
+func NewDryRunService(inner DNSService, name string, logger *zap.Logger) *DryRunService {
+	return &DryRunService{
+		inner:  inner,
+		name:   name,
+		logger: logger,
+	}
+}
+
+func (s *DryRunService) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	s.logger.Info("dry run: would create DNS record",
+		zap.String("domain", domain),
+		zap.String("record_type", recordType),
+		zap.String("value", value),
+		zap.String("provider", s.name))
+	return nil
+}
+
+func (s *DryRunService) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	s.logger.Info("dry run: would delete DNS record",
+		zap.String("domain", domain),
+		zap.String("record_type", recordType),
+		zap.String("provider", s.name))
+	return nil
+}
+
+func (s *DryRunService) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	s.logger.Info("dry run: would update DNS record",
+		zap.String("domain", domain),
+		zap.String("record_type", recordType),
+		zap.String("value", value),
+		zap.String("provider", s.name))
+	return nil
+}
+
+func (s *DryRunService) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	s.logger.Info("dry run: would change DNS record state",
+		zap.String("domain", domain),
+		zap.String("record_type", recordType),
+		zap.Bool("enabled", enabled),
+		zap.String("provider", s.name))
+	return nil
+}
+
+func (s *DryRunService) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	return s.inner.FindRecord(ctx, domain)
+}
+
+func (s *DryRunService) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	return ListRecords(ctx, s.inner)
+}
+
+func (s *DryRunService) Validate(ctx context.Context) error {
+	return s.inner.Validate(ctx)
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*DryRunService)(nil)
+	_ Toggler    = (*DryRunService)(nil)
+	_ Lister     = (*DryRunService)(nil)
+)
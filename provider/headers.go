@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// modulePath identifies this module in the build info
+const modulePath = "github.com/mietzen/caddy-local-dns"
+
+// DefaultUserAgent is sent by providers without a configured User-Agent
+var DefaultUserAgent = "caddy-local-dns/" + moduleVersion()
+
+// moduleVersion returns the version this module was built with, e.g. by
+// xcaddy, or "devel" if it isn't known
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		if dep.Version != "" {
+			return dep.Version
+		}
+	}
+	return "devel"
+}
+
+// headerTransport sets the User-Agent and extra headers of each request
+type headerTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	headers   map[string]string
+}
+
+// withHeaders wraps base so requests carry userAgent, DefaultUserAgent when
+// empty, and headers. headers take precedence over those set by providers.
+func withHeaders(base http.RoundTripper, userAgent string, headers map[string]string) http.RoundTripper {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	return &headerTransport{base: base, userAgent: userAgent, headers: headers}
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(req)
+}
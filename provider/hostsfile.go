@@ -0,0 +1,335 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Markers delimiting the section of a hosts file managed by this plugin
+const (
+	hostsBeginMarker = "# BEGIN Caddy Local DNS"
+	hostsEndMarker   = "# END Caddy Local DNS"
+)
+
+// HostsFileProvider implements DNSService for a hosts file on the local
+// machine. Only the section between the marker comments is rewritten, manual
+// entries are left alone.
+type HostsFileProvider struct {
+	path   string
+	mu     sync.Mutex // serializes changes within this process
+	logger *zap.Logger
+	debug  bool
+
+	conflictMu sync.Mutex
+	conflicts  map[string]bool // domains with manual entries, warned about once
+}
+
+// NewHostsFileProvider creates a new hosts file provider for path, which
+// defaults to /etc/hosts. Changes lock path + ".lock" so other processes
+// using the same convention don't interfere.
+func NewHostsFileProvider(path string, logger *zap.Logger, debug bool) (*HostsFileProvider, error) {
+	if path == "" {
+		path = "/etc/hosts"
+	}
+
+	if debug {
+		logger.Debug("hosts file provider created", zap.String("path", path))
+	}
+
+	return &HostsFileProvider{
+		path:      path,
+		logger:    logger,
+		debug:     debug,
+		conflicts: make(map[string]bool),
+	}, nil
+}
+
+func (p *HostsFileProvider) CreateRecord(ctx context.Context, domain, recordType, ip string) error {
+	if err := checkHostsRecord(domain, recordType); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("creating hosts file entry",
+			zap.String("domain", domain),
+			zap.String("ip", ip))
+	}
+
+	return p.modify(func(managed []string) []string {
+		return append(managed, ip+" "+domain)
+	})
+}
+
+func (p *HostsFileProvider) UpdateRecord(ctx context.Context, domain, recordType, ip string) error {
+	if err := checkHostsRecord(domain, recordType); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("updating hosts file entry", zap.String("domain", domain), zap.String("ip", ip))
+	}
+
+	// Replace all entries of the same family in a single rewrite
+	return p.modify(func(managed []string) []string {
+		managed = removeHostsEntries(managed, domain, recordType)
+		return append(managed, ip+" "+domain)
+	})
+}
+
+func (p *HostsFileProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting hosts file entry", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	return p.modify(func(managed []string) []string {
+		return removeHostsEntries(managed, domain, recordType)
+	})
+}
+
+func (p *HostsFileProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if p.debug {
+		p.logger.Debug("searching hosts file entries", zap.String("domain", domain))
+	}
+
+	lines, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+	before, managed, after := splitHostsSection(lines)
+
+	// Manual entries can't be changed, so they aren't reported. They would
+	// count as stale records and have the managed ones replaced on each pass.
+	var manual []*DNSRecord
+	for _, line := range append(before, after...) {
+		ip, names, comment := parseHostsLine(line)
+		manual = appendHostsRecords(manual, domain, ip, names, comment)
+	}
+	if len(manual) > 0 {
+		p.warnConflict(domain, manual)
+	}
+
+	var records []*DNSRecord
+	for _, line := range managed {
+		ip, names, _ := parseHostsLine(line)
+		records = appendHostsRecords(records, domain, ip, names, managedDescription)
+	}
+
+	if p.debug {
+		p.logger.Debug("found hosts file entries", zap.String("domain", domain), zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+// warnConflict logs the manual entries of domain, once per domain
+func (p *HostsFileProvider) warnConflict(domain string, manual []*DNSRecord) {
+	p.conflictMu.Lock()
+	defer p.conflictMu.Unlock()
+	if p.conflicts[strings.ToLower(domain)] {
+		return
+	}
+	p.conflicts[strings.ToLower(domain)] = true
+
+	var values []string
+	for _, record := range manual {
+		values = append(values, record.Value)
+	}
+	p.logger.Warn("manual hosts file entries exist outside of the managed section, they are left alone and may take precedence",
+		zap.String("domain", domain),
+		zap.Strings("values", values),
+		zap.String("path", p.path))
+}
+
+// ListRecords returns the entries of the managed section
+func (p *HostsFileProvider) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	lines, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+	_, managed, _ := splitHostsSection(lines)
+
+	var records []*DNSRecord
+	for _, line := range managed {
+		ip, names, _ := parseHostsLine(line)
+		for _, name := range names {
+			records = appendHostsRecords(records, name, ip, []string{name}, managedDescription)
+		}
+	}
+	return records, nil
+}
+
+func (p *HostsFileProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating hosts file access", zap.String("path", p.path))
+	}
+
+	f, err := os.OpenFile(p.path, os.O_RDWR, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Created with the first record
+		_, err = os.Stat(filepath.Dir(p.path))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// modify rewrites the managed section with the result of change while
+// holding the lock
+func (p *HostsFileProvider) modify(change func(managed []string) []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lock, err := os.OpenFile(p.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", p.path, err)
+	}
+
+	lines, err := p.read()
+	if err != nil {
+		return err
+	}
+	before, managed, after := splitHostsSection(lines)
+	managed = change(managed)
+
+	// The section is dropped once empty and appended when new
+	out := before
+	if len(managed) > 0 {
+		out = append(out, hostsBeginMarker)
+		out = append(out, managed...)
+		out = append(out, hostsEndMarker)
+	}
+	out = append(out, after...)
+
+	content := strings.Join(out, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	return p.write(content)
+}
+
+// read returns the lines of the hosts file, none if it doesn't exist
+func (p *HostsFileProvider) read() ([]string, error) {
+	data, err := os.ReadFile(p.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	content := strings.TrimRight(string(data), "\n")
+	if content == "" {
+		return nil, nil
+	}
+	return strings.Split(content, "\n"), nil
+}
+
+// write replaces the hosts file atomically by renaming a temporary file
+func (p *HostsFileProvider) write(content string) error {
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(p.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), ".caddy-local-dns-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), p.path); err != nil {
+		// /etc/hosts is often bind-mounted into containers and can't be
+		// replaced, fall back to rewriting it in place
+		if p.debug {
+			p.logger.Debug("failed to replace hosts file, writing in place", zap.Error(err))
+		}
+		return os.WriteFile(p.path, []byte(content), mode)
+	}
+	return nil
+}
+
+// splitHostsSection splits lines into those before, within and after the
+// managed section. Without a section, all lines are before it.
+func splitHostsSection(lines []string) (before, managed, after []string) {
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case hostsBeginMarker:
+			if begin == -1 {
+				begin = i
+			}
+		case hostsEndMarker:
+			if begin != -1 && end == -1 {
+				end = i
+			}
+		}
+	}
+	if begin == -1 || end == -1 {
+		return lines[:len(lines):len(lines)], nil, nil
+	}
+	// Capped, so appending to a part never overwrites the next one
+	return lines[:begin:begin], lines[begin+1 : end : end], lines[end+1:]
+}
+
+// appendHostsRecords appends a record for each name of a hosts line that
+// matches domain
+func appendHostsRecords(records []*DNSRecord, domain, ip string, names []string, description string) []*DNSRecord {
+	for _, name := range names {
+		if !strings.EqualFold(name, domain) {
+			continue
+		}
+		records = append(records, &DNSRecord{
+			Domain:      domain,
+			Value:       ip,
+			RecordType:  RecordTypeForIP(ip),
+			Enabled:     true,
+			Description: description,
+		})
+	}
+	return records
+}
+
+// checkHostsRecord rejects records a hosts file can't hold
+func checkHostsRecord(domain, recordType string) error {
+	if IsWildcard(domain) {
+		return fmt.Errorf("wildcard records are not supported by hosts files: %s", domain)
+	}
+	if recordType != "A" && recordType != "AAAA" {
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "hosts files"}
+	}
+	return nil
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*HostsFileProvider)(nil)
+	_ Lister     = (*HostsFileProvider)(nil)
+)
@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestHostsFileIgnoresManualEntries(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1 localhost\n192.168.1.5 app.lan\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewHostsFileProvider(path, zap.NewNop(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := p.FindRecord(ctx, "app.lan")
+	if err != nil {
+		t.Fatalf("FindRecord: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected the manual entry to be ignored, got %+v", records)
+	}
+
+	if err := p.CreateRecord(ctx, "app.lan", "A", "192.168.1.50"); err != nil {
+		t.Fatalf("CreateRecord: %v", err)
+	}
+	records, err = p.FindRecord(ctx, "app.lan")
+	if err != nil {
+		t.Fatalf("FindRecord: %v", err)
+	}
+	if len(records) != 1 || records[0].Value != "192.168.1.50" {
+		t.Errorf("expected only the managed entry, got %+v", records)
+	}
+}
@@ -0,0 +1,323 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// defaultKnotTTL is used for new records when no TTL is configured
+const defaultKnotTTL = 300
+
+// KnotProvider implements DNSService for Knot DNS by running knotc against
+// the server's control socket. Every change is made in a zone transaction
+// that is aborted when any step fails.
+type KnotProvider struct {
+	zone    string // canonical, with trailing dot
+	socket  string
+	knotc   string
+	ttl     int
+	timeout time.Duration
+	mu      sync.Mutex // Knot allows a single transaction per zone
+	logger  *zap.Logger
+	debug   bool
+}
+
+// NewKnotProvider creates a new Knot DNS provider for zone. socket is the
+// control socket passed to knotc -s, knotc uses its default when empty.
+// knotcPath defaults to knotc from PATH.
+func NewKnotProvider(zone, socket, knotcPath string, ttl int, timeout time.Duration, logger *zap.Logger, debug bool) (*KnotProvider, error) {
+	if zone == "" {
+		return nil, errors.New("knot provider requires zone")
+	}
+
+	if knotcPath == "" {
+		knotcPath = "knotc"
+	}
+
+	if ttl <= 0 {
+		ttl = defaultKnotTTL
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	if debug {
+		logger.Debug("Knot provider created",
+			zap.String("zone", dns.Fqdn(zone)),
+			zap.String("socket", socket),
+			zap.String("knotc_path", knotcPath),
+			zap.Int("ttl", ttl),
+			zap.Duration("timeout", timeout))
+	}
+
+	return &KnotProvider{
+		zone:    dns.Fqdn(zone),
+		socket:  socket,
+		knotc:   knotcPath,
+		ttl:     ttl,
+		timeout: timeout,
+		logger:  logger,
+		debug:   debug,
+	}, nil
+}
+
+func (p *KnotProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := p.checkRecord(domain, recordType, value); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("creating Knot record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	if err := p.transaction(ctx, func() error {
+		return p.set(ctx, domain, recordType, value)
+	}); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("Knot record created successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *KnotProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := p.checkRecord(domain, recordType, value); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("updating Knot record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	// The old RRset is replaced within the same transaction
+	if err := p.transaction(ctx, func() error {
+		if err := p.unset(ctx, domain, recordType); err != nil {
+			return err
+		}
+		return p.set(ctx, domain, recordType, value)
+	}); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("Knot record updated successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *KnotProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if err := p.checkDomain(domain); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("deleting Knot record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	if err := p.transaction(ctx, func() error {
+		return p.unset(ctx, domain, recordType)
+	}); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("Knot record deleted successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *KnotProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if err := p.checkDomain(domain); err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("searching Knot records", zap.String("domain", domain))
+	}
+
+	var records []*DNSRecord
+	for _, recordType := range []string{"A", "AAAA"} {
+		found, err := p.read(ctx, "zone-read", domain, recordType)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+	}
+
+	if p.debug {
+		p.logger.Debug("found Knot records", zap.String("domain", domain), zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *KnotProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating Knot setup", zap.String("knotc_path", p.knotc), zap.String("zone", p.zone))
+	}
+
+	if _, err := exec.LookPath(p.knotc); err != nil {
+		return fmt.Errorf("knotc not found: %w", err)
+	}
+	// Fails if the server isn't reachable or doesn't serve the zone
+	_, err := p.run(ctx, "zone-status", p.zone)
+	return err
+}
+
+// transaction runs change between zone-begin and zone-commit, the
+// transaction is aborted if change or the commit fails
+func (p *KnotProvider) transaction(ctx context.Context, change func() error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.run(ctx, "zone-begin", p.zone); err != nil {
+		return err
+	}
+
+	err := change()
+	if err == nil {
+		_, err = p.run(ctx, "zone-commit", p.zone)
+	}
+	if err != nil {
+		// ctx may be done already, the abort must still reach the server
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.timeout)
+		defer cancel()
+		if _, abortErr := p.run(abortCtx, "zone-abort", p.zone); abortErr != nil {
+			p.logger.Error("failed to abort Knot zone transaction",
+				zap.String("zone", p.zone),
+				zap.Error(abortErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// set adds a record within the open transaction
+func (p *KnotProvider) set(ctx context.Context, domain, recordType, value string) error {
+	_, err := p.run(ctx, "zone-set", p.zone, dns.Fqdn(domain), strconv.Itoa(p.ttl), recordType, value)
+	return err
+}
+
+// unset removes the RRset of domain and recordType within the open
+// transaction. Knot fails on missing records, so the RRset is looked up first.
+func (p *KnotProvider) unset(ctx context.Context, domain, recordType string) error {
+	existing, err := p.read(ctx, "zone-get", domain, recordType)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil // Already deleted
+	}
+	_, err = p.run(ctx, "zone-unset", p.zone, dns.Fqdn(domain), recordType)
+	return err
+}
+
+// read returns the records of domain and recordType. command is zone-read
+// for the committed zone or zone-get within a transaction.
+func (p *KnotProvider) read(ctx context.Context, command, domain, recordType string) ([]*DNSRecord, error) {
+	out, err := p.run(ctx, command, p.zone, dns.Fqdn(domain), recordType)
+	if err != nil {
+		// A missing name or type is reported as an error
+		if strings.Contains(err.Error(), "no such") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Lines look like "[zone.] owner. ttl type data"
+	var records []*DNSRecord
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "[") {
+			fields = fields[1:]
+		}
+		if len(fields) < 4 || fields[2] != recordType {
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSuffix(fields[0], "."), strings.TrimSuffix(domain, ".")) {
+			continue
+		}
+		records = append(records, &DNSRecord{
+			Domain:     domain,
+			Value:      fields[3],
+			RecordType: recordType,
+			Enabled:    true,
+		})
+	}
+	return records, nil
+}
+
+// checkRecord rejects records the provider doesn't manage
+func (p *KnotProvider) checkRecord(domain, recordType, value string) error {
+	if err := p.checkDomain(domain); err != nil {
+		return err
+	}
+	if recordType != "A" && recordType != "AAAA" {
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "the Knot provider"}
+	}
+	if RecordTypeForIP(value) != recordType {
+		return fmt.Errorf("invalid %s record value for %s: %q", recordType, domain, value)
+	}
+	return nil
+}
+
+// checkDomain makes sure domain belongs to the configured zone and is a
+// single knotc argument
+func (p *KnotProvider) checkDomain(domain string) error {
+	if strings.ContainsAny(domain, " \t\r\n") {
+		return fmt.Errorf("invalid domain %q", domain)
+	}
+	if !inZone(domain, p.zone) {
+		return fmt.Errorf("domain %s is not part of zone %s", domain, p.zone)
+	}
+	return nil
+}
+
+// run executes a knotc command and returns its output
+func (p *KnotProvider) run(ctx context.Context, args ...string) (string, error) {
+	// -t bounds the wait for the server's reply
+	base := []string{"-t", fmt.Sprint(int(p.timeout.Seconds()))}
+	if p.socket != "" {
+		base = append(base, "-s", p.socket)
+	}
+	args = append(base, args...)
+
+	if p.debug {
+		p.logger.Debug("running knotc", zap.String("knotc_path", p.knotc), zap.Strings("args", args))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.knotc, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if p.debug {
+			p.logger.Debug("knotc failed", zap.String("stdout", stdout.String()), zap.Error(err))
+		}
+		// knotc reports errors like "error: (no such record in zone found)"
+		message := strings.TrimSpace(stderr.String() + " " + stdout.String())
+		if message != "" {
+			return "", fmt.Errorf("knotc %s failed: %w: %s", args[len(base)], err, message)
+		}
+		return "", fmt.Errorf("knotc %s failed: %w", args[len(base)], err)
+	}
+	return stdout.String(), nil
+}
+
+// Interface compliance
+var _ DNSService = (*KnotProvider)(nil)
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package provider
+
+import "os"
+
+// lockFile is a no-op without flock, writers within this process are still
+// serialized by the provider's mutex
+func lockFile(f *os.File) error {
+	return nil
+}
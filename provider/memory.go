@@ -0,0 +1,167 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// MemoryProvider implements DNSService with records kept in memory. It needs
+// no DNS server, which makes it useful to try out configurations and in tests.
+// Records are lost when Caddy stops.
+type MemoryProvider struct {
+	mu      sync.Mutex
+	records map[string][]*DNSRecord // by lowercased domain
+	logger  *zap.Logger
+	debug   bool
+}
+
+// NewMemoryProvider creates a new, empty memory provider
+func NewMemoryProvider(logger *zap.Logger, debug bool) *MemoryProvider {
+	if debug {
+		logger.Debug("memory provider created")
+	}
+
+	return &MemoryProvider{
+		records: make(map[string][]*DNSRecord),
+		logger:  logger,
+		debug:   debug,
+	}
+}
+
+func (p *MemoryProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if !strings.Contains(domain, ".") {
+		return fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := strings.ToLower(domain)
+	p.records[key] = append(p.records[key], &DNSRecord{
+		Domain:      domain,
+		Value:       value,
+		RecordType:  recordType,
+		Enabled:     true,
+		Description: recordDescription(ctx, managedDescription),
+	})
+
+	p.logger.Info("memory provider: created record",
+		zap.String("domain", domain),
+		zap.String("record_type", recordType),
+		zap.String("value", value))
+	return nil
+}
+
+func (p *MemoryProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Replace all records of the type, like the other providers drop duplicates
+	key := strings.ToLower(domain)
+	records := removeRecords(p.records[key], recordType)
+	p.records[key] = append(records, &DNSRecord{
+		Domain:      domain,
+		Value:       value,
+		RecordType:  recordType,
+		Enabled:     true,
+		Description: recordDescription(ctx, managedDescription),
+	})
+
+	p.logger.Info("memory provider: updated record",
+		zap.String("domain", domain),
+		zap.String("record_type", recordType),
+		zap.String("value", value))
+	return nil
+}
+
+func (p *MemoryProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := strings.ToLower(domain)
+	records := removeRecords(p.records[key], recordType)
+	if len(records) == 0 {
+		delete(p.records, key)
+	} else {
+		p.records[key] = records
+	}
+
+	p.logger.Info("memory provider: deleted record",
+		zap.String("domain", domain),
+		zap.String("record_type", recordType))
+	return nil
+}
+
+func (p *MemoryProvider) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, record := range filterRecords(p.records[strings.ToLower(domain)], recordType) {
+		record.Enabled = enabled
+	}
+
+	p.logger.Info("memory provider: changed record state",
+		zap.String("domain", domain),
+		zap.String("record_type", recordType),
+		zap.Bool("enabled", enabled))
+	return nil
+}
+
+func (p *MemoryProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Return copies so callers can't change the stored records
+	var records []*DNSRecord
+	for _, record := range p.records[strings.ToLower(domain)] {
+		copied := *record
+		records = append(records, &copied)
+	}
+
+	if p.debug {
+		p.logger.Debug("found memory records", zap.String("domain", domain), zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *MemoryProvider) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var records []*DNSRecord
+	for _, stored := range p.records {
+		for _, record := range stored {
+			if isManaged(record.Description, managedDescription) {
+				copied := *record
+				records = append(records, &copied)
+			}
+		}
+	}
+	return records, nil
+}
+
+func (p *MemoryProvider) Validate(ctx context.Context) error {
+	return nil
+}
+
+// removeRecords returns the records not of the given type
+func removeRecords(records []*DNSRecord, recordType string) []*DNSRecord {
+	var out []*DNSRecord
+	for _, record := range records {
+		if record.RecordType != recordType {
+			out = append(out, record)
+		}
+	}
+	return out
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*MemoryProvider)(nil)
+	_ Toggler    = (*MemoryProvider)(nil)
+	_ Lister     = (*MemoryProvider)(nil)
+)
@@ -0,0 +1,413 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MikrotikProvider implements DNSService for the static DNS entries of
+// RouterOS through its REST API (RouterOS 7.1 or later)
+type MikrotikProvider struct {
+	baseURL  string
+	username string
+	password string
+	ttl      int
+	client   *http.Client
+	logger   *zap.Logger
+	debug    bool
+}
+
+// mikrotikEntry is an entry of /ip/dns/static. RouterOS returns all values
+// as strings, an entry without type is an A or AAAA record.
+type mikrotikEntry struct {
+	ID       string `json:".id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Address  string `json:"address,omitempty"`
+	CNAME    string `json:"cname,omitempty"`
+	Text     string `json:"text,omitempty"`
+	TTL      string `json:"ttl,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+	Disabled string `json:"disabled,omitempty"`
+}
+
+// NewMikrotikProvider creates a new RouterOS provider. hostname may include
+// a scheme, HTTPS is used otherwise.
+func NewMikrotikProvider(hostname, username, password string, ttl int, timeout time.Duration, tlsConfig *tls.Config, logger *zap.Logger, debug bool) (*MikrotikProvider, error) {
+	if hostname == "" || username == "" {
+		return nil, errors.New("mikrotik provider requires hostname and api_key (username)")
+	}
+
+	// The REST API is served by the www-ssl service by default
+	baseURL := hostname
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	// A nil tlsConfig keeps the default verification
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+	}
+
+	if debug {
+		logger.Debug("Mikrotik provider created",
+			zap.String("base_url", baseURL),
+			zap.Int("ttl", ttl),
+			zap.Duration("timeout", timeout),
+			zap.Bool("custom_tls", tlsConfig != nil))
+	}
+
+	return &MikrotikProvider{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		ttl:      ttl,
+		client:   client,
+		logger:   logger,
+		debug:    debug,
+	}, nil
+}
+
+func (p *MikrotikProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if !strings.Contains(domain, ".") {
+		return fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+
+	if p.debug {
+		p.logger.Debug("creating Mikrotik static DNS entry",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	entry, err := p.newEntry(ctx, domain, recordType, value)
+	if err != nil {
+		return err
+	}
+	resp, err := p.apiCall(ctx, "PUT", "", entry)
+	if err != nil {
+		return err
+	}
+	// The created entry is returned
+	var created mikrotikEntry
+	if err := json.Unmarshal(resp, &created); err == nil {
+		setRecordID(ctx, created.ID)
+	}
+
+	if p.debug {
+		p.logger.Debug("Mikrotik static DNS entry created successfully", zap.String("domain", domain), zap.String("id", created.ID))
+	}
+	return nil
+}
+
+func (p *MikrotikProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("updating Mikrotik static DNS entry", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	entry, err := p.newEntry(ctx, domain, recordType, value)
+	if err != nil {
+		return err
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		p.logger.Info("record not found during update, creating new one", zap.String("domain", domain))
+		return p.CreateRecord(ctx, domain, recordType, value)
+	}
+
+	// Overwrite the first entry and drop any duplicates
+	if _, err := p.apiCall(ctx, "PATCH", existing[0].UUID, entry); err != nil {
+		return err
+	}
+	for _, record := range existing[1:] {
+		if _, err := p.apiCall(ctx, "DELETE", record.UUID, nil); err != nil {
+			return err
+		}
+	}
+	setRecordID(ctx, existing[0].UUID)
+
+	if p.debug {
+		p.logger.Debug("Mikrotik static DNS entry updated successfully", zap.String("domain", domain), zap.String("id", existing[0].UUID))
+	}
+	return nil
+}
+
+func (p *MikrotikProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting Mikrotik static DNS entry", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		if p.debug {
+			p.logger.Debug("record not found, nothing to delete", zap.String("domain", domain))
+		}
+		return nil // Already deleted
+	}
+
+	for _, record := range existing {
+		if _, err := p.apiCall(ctx, "DELETE", record.UUID, nil); err != nil {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("Mikrotik static DNS entry deleted successfully", zap.String("domain", domain), zap.Int("count", len(existing)))
+	}
+	return nil
+}
+
+func (p *MikrotikProvider) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range filterRecords(records, recordType) {
+		if record.Enabled == enabled {
+			continue
+		}
+		if _, err := p.apiCall(ctx, "PATCH", record.UUID, mikrotikEntry{Disabled: fmt.Sprint(!enabled)}); err != nil {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("Mikrotik static DNS entry state changed", zap.String("domain", domain), zap.Bool("enabled", enabled))
+	}
+	return nil
+}
+
+func (p *MikrotikProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if !strings.Contains(domain, ".") {
+		return nil, fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+
+	if p.debug {
+		p.logger.Debug("searching Mikrotik static DNS entries", zap.String("domain", domain))
+	}
+
+	entries, err := p.entries(ctx, url.Values{"name": {domain}})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, entry := range entries {
+		record := entry.record()
+		if record == nil || !strings.EqualFold(entry.Name, domain) {
+			continue
+		}
+
+		if p.debug {
+			p.logger.Debug("found matching Mikrotik static DNS entry",
+				zap.String("domain", domain),
+				zap.String("id", entry.ID),
+				zap.String("record_type", record.RecordType),
+				zap.String("value", record.Value),
+				zap.String("disabled", entry.Disabled))
+		}
+		record.Domain = domain
+		records = append(records, record)
+	}
+
+	if p.debug && len(records) == 0 {
+		p.logger.Debug("no matching Mikrotik static DNS entry found", zap.String("domain", domain))
+	}
+	return records, nil
+}
+
+// ListRecords returns the static DNS entries commented by this plugin
+func (p *MikrotikProvider) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	// Queries match comments exactly, tagged entries are filtered below
+	entries, err := p.entries(ctx, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, entry := range entries {
+		if record := entry.record(); record != nil && isManaged(entry.Comment, managedDescription) {
+			records = append(records, record)
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("found managed Mikrotik static DNS entries", zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *MikrotikProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating Mikrotik connectivity", zap.String("base_url", p.baseURL))
+	}
+
+	// Listing a missing name is cheap and needs the same read permission
+	_, err := p.entries(ctx, url.Values{"name": {"caddy-local-dns.invalid"}})
+	return err
+}
+
+// entries returns the static DNS entries matching query
+func (p *MikrotikProvider) entries(ctx context.Context, query url.Values) ([]mikrotikEntry, error) {
+	resp, err := p.apiCall(ctx, "GET", "?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []mikrotikEntry
+	if err := json.Unmarshal(resp, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// newEntry returns the payload creating or replacing a record
+func (p *MikrotikProvider) newEntry(ctx context.Context, domain, recordType, value string) (mikrotikEntry, error) {
+	entry := mikrotikEntry{
+		Name:    domain,
+		Type:    recordType,
+		Comment: recordDescription(ctx, managedDescription),
+	}
+	if p.ttl > 0 {
+		entry.TTL = fmt.Sprintf("%ds", p.ttl)
+	}
+
+	switch recordType {
+	case "A", "AAAA":
+		entry.Address = value
+	case "CNAME":
+		entry.CNAME = value
+	case "TXT":
+		entry.Text = value
+	default:
+		return mikrotikEntry{}, ErrUnsupportedRecordType{RecordType: recordType, Backend: "the Mikrotik provider"}
+	}
+	return entry, nil
+}
+
+// record converts the entry to a DNSRecord, or nil for unmanaged types
+func (e mikrotikEntry) record() *DNSRecord {
+	record := &DNSRecord{
+		Domain:      e.Name,
+		RecordType:  e.Type,
+		UUID:        e.ID,
+		Enabled:     e.Disabled != "true",
+		Description: e.Comment,
+	}
+	switch e.Type {
+	case "", "A", "AAAA":
+		record.Value = e.Address
+		record.RecordType = RecordTypeForIP(e.Address)
+	case "CNAME":
+		record.Value = e.CNAME
+	case "TXT":
+		record.Value = e.Text
+	default:
+		return nil
+	}
+	return record
+}
+
+// apiCall sends a request to /rest/ip/dns/static, path is appended to it
+func (p *MikrotikProvider) apiCall(ctx context.Context, method, path string, payload any) ([]byte, error) {
+	apiURL := p.baseURL + "/rest/ip/dns/static"
+	if strings.HasPrefix(path, "?") {
+		apiURL += path
+	} else if path != "" {
+		apiURL += "/" + url.PathEscape(path)
+	}
+
+	if p.debug {
+		p.logger.Debug("making API call",
+			zap.String("method", method),
+			zap.String("url", apiURL),
+			zap.Any("payload", payload))
+	}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(p.username, p.password)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.debug {
+			p.logger.Debug("API call failed", zap.Error(err))
+		}
+		if strings.Contains(err.Error(), "certificate") || strings.Contains(err.Error(), "tls") {
+			return nil, fmt.Errorf("SSL/TLS error connecting to RouterOS API. If using self-signed certificates, set 'ca_cert' or enable 'insecure' option: %w", err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("API call response",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(out)))
+	}
+
+	if resp.StatusCode >= 400 {
+		// Errors are reported as {"error": 400, "message": ..., "detail": ...}
+		var res struct {
+			Message string `json:"message"`
+			Detail  string `json:"detail"`
+		}
+		if err := json.Unmarshal(out, &res); err == nil && res.Message != "" {
+			return nil, fmt.Errorf("api error %d: %s: %s", resp.StatusCode, res.Message, res.Detail)
+		}
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, string(out))
+	}
+	return out, nil
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*MikrotikProvider)(nil)
+	_ Toggler    = (*MikrotikProvider)(nil)
+	_ Lister     = (*MikrotikProvider)(nil)
+)
@@ -0,0 +1,295 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// nextDNSAPI is the base URL of the NextDNS API
+const nextDNSAPI = "https://api.nextdns.io"
+
+// NextDNSRateLimit is the default calls per second to the NextDNS API,
+// which throttles bursts of requests with 429 Too Many Requests
+const NextDNSRateLimit = 2
+
+// NextDNSProvider implements DNSService for the rewrites of a NextDNS
+// profile. Rewrites have no type or TTL, the type follows from the address.
+type NextDNSProvider struct {
+	apiKey    string
+	profileID string
+	client    *http.Client
+	logger    *zap.Logger
+	debug     bool
+}
+
+// nextDNSRewrite is an entry of the rewrites API
+type nextDNSRewrite struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// NewNextDNSProvider creates a new NextDNS provider for the profile with
+// profileID
+func NewNextDNSProvider(apiKey, profileID string, timeout time.Duration, logger *zap.Logger, debug bool) (*NextDNSProvider, error) {
+	if apiKey == "" || profileID == "" {
+		return nil, errors.New("nextdns provider requires api_key and profile_id")
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout: timeout,
+	}
+
+	if debug {
+		logger.Debug("NextDNS provider created",
+			zap.String("profile_id", profileID),
+			zap.Duration("timeout", timeout))
+	}
+
+	return &NextDNSProvider{
+		apiKey:    apiKey,
+		profileID: profileID,
+		client:    client,
+		logger:    logger,
+		debug:     debug,
+	}, nil
+}
+
+func (p *NextDNSProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := checkNextDNSRecord(domain, recordType, value); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("creating NextDNS rewrite",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	resp, err := p.apiCall(ctx, "POST", "rewrites", nextDNSRewrite{Name: domain, Content: value})
+	if err != nil {
+		return err
+	}
+	var created nextDNSRewrite
+	if err := json.Unmarshal(resp, &created); err == nil {
+		setRecordID(ctx, created.ID)
+	}
+
+	if p.debug {
+		p.logger.Debug("NextDNS rewrite created successfully", zap.String("domain", domain), zap.String("id", created.ID))
+	}
+	return nil
+}
+
+func (p *NextDNSProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := checkNextDNSRecord(domain, recordType, value); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("updating NextDNS rewrite", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	// Rewrites can't be modified, they are replaced instead
+	if err := p.DeleteRecord(ctx, domain, recordType); err != nil {
+		return err
+	}
+	return p.CreateRecord(ctx, domain, recordType, value)
+}
+
+func (p *NextDNSProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting NextDNS rewrite", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		if p.debug {
+			p.logger.Debug("rewrite not found, nothing to delete", zap.String("domain", domain))
+		}
+		return nil // Already deleted
+	}
+
+	for _, record := range existing {
+		_, err := p.apiCall(ctx, "DELETE", "rewrites/"+url.PathEscape(record.UUID), nil)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("NextDNS rewrite deleted successfully", zap.String("domain", domain), zap.Int("count", len(existing)))
+	}
+	return nil
+}
+
+func (p *NextDNSProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if p.debug {
+		p.logger.Debug("searching NextDNS rewrites", zap.String("domain", domain))
+	}
+
+	rows, err := p.rewrites(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, row := range rows {
+		if !strings.EqualFold(row.Name, domain) {
+			continue
+		}
+		// Rewrites to host names aren't address records
+		if net.ParseIP(row.Content) == nil {
+			continue
+		}
+		records = append(records, &DNSRecord{
+			Domain:     domain,
+			Value:      row.Content,
+			RecordType: RecordTypeForIP(row.Content),
+			UUID:       row.ID,
+			Enabled:    true,
+		})
+	}
+
+	if p.debug {
+		p.logger.Debug("found NextDNS rewrites", zap.String("domain", domain), zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *NextDNSProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating NextDNS profile access", zap.String("profile_id", p.profileID))
+	}
+
+	_, err := p.rewrites(ctx)
+	return err
+}
+
+// rewrites returns all rewrites of the profile
+func (p *NextDNSProvider) rewrites(ctx context.Context) ([]nextDNSRewrite, error) {
+	resp, err := p.apiCall(ctx, "GET", "rewrites", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []nextDNSRewrite
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// checkNextDNSRecord rejects records the provider doesn't manage
+func checkNextDNSRecord(domain, recordType, value string) error {
+	if recordType != "A" && recordType != "AAAA" {
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "the NextDNS provider"}
+	}
+	if RecordTypeForIP(value) != recordType {
+		return fmt.Errorf("invalid %s record value for %s: %q", recordType, domain, value)
+	}
+	return nil
+}
+
+// apiCall sends a request below the profile's endpoint and returns the
+// "data" of a successful response
+func (p *NextDNSProvider) apiCall(ctx context.Context, method, endpoint string, payload any) ([]byte, error) {
+	apiURL := fmt.Sprintf("%s/profiles/%s/%s", nextDNSAPI, url.PathEscape(p.profileID), endpoint)
+
+	if p.debug {
+		p.logger.Debug("making API call",
+			zap.String("method", method),
+			zap.String("url", apiURL),
+			zap.Any("payload", payload))
+	}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Api-Key", p.apiKey)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.debug {
+			p.logger.Debug("API call failed", zap.Error(err))
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("API call response",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(out)))
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// Retried with retry_attempts
+		return nil, fmt.Errorf("%w: rate limited by NextDNS: %s", ErrUnavailable, string(out))
+	}
+	if resp.StatusCode >= 400 {
+		return nil, statusError(resp.StatusCode, out)
+	}
+
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil // DELETE answers 204 No Content
+	}
+
+	// Errors may also be reported with a 200 status
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, string(out))
+	}
+	if len(res.Errors) > 0 {
+		var messages []string
+		for _, e := range res.Errors {
+			messages = append(messages, strings.TrimSpace(e.Code+" "+e.Detail))
+		}
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, strings.Join(messages, "; "))
+	}
+	return res.Data, nil
+}
+
+// Interface compliance
+var _ DNSService = (*NextDNSProvider)(nil)
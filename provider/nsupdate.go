@@ -0,0 +1,258 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// NsupdateProvider implements DNSService by running the nsupdate utility of
+// BIND. Lookups are sent to the server directly.
+type NsupdateProvider struct {
+	host     string
+	port     string
+	zone     string // canonical, with trailing dot
+	keyFile  string
+	nsupdate string
+	ttl      int
+	timeout  time.Duration
+	lookup   *RFC2136Provider
+	logger   *zap.Logger
+	debug    bool
+}
+
+// NewNsupdateProvider creates a new nsupdate provider. server is the address
+// of the primary name server (port 53 unless given), keyFile is passed to
+// nsupdate -k if set. nsupdatePath defaults to nsupdate from PATH.
+func NewNsupdateProvider(server, zone, keyFile, nsupdatePath string, ttl int, timeout time.Duration, logger *zap.Logger, debug bool) (*NsupdateProvider, error) {
+	if server == "" || zone == "" {
+		return nil, errors.New("nsupdate provider requires hostname and zone")
+	}
+
+	if nsupdatePath == "" {
+		nsupdatePath = "nsupdate"
+	}
+
+	if ttl <= 0 {
+		ttl = defaultRFC2136TTL
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	// Queries need no key, use the RFC 2136 provider for lookups
+	lookup, err := NewRFC2136Provider(server, zone, "", "", "", ttl, timeout, logger, false)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(lookup.server)
+	if err != nil {
+		return nil, err
+	}
+
+	if debug {
+		logger.Debug("nsupdate provider created",
+			zap.String("server", lookup.server),
+			zap.String("zone", dns.Fqdn(zone)),
+			zap.String("key_file", keyFile),
+			zap.String("nsupdate_path", nsupdatePath),
+			zap.Int("ttl", ttl),
+			zap.Duration("timeout", timeout))
+	}
+
+	return &NsupdateProvider{
+		host:     host,
+		port:     port,
+		zone:     dns.Fqdn(zone),
+		keyFile:  keyFile,
+		nsupdate: nsupdatePath,
+		ttl:      ttl,
+		timeout:  timeout,
+		lookup:   lookup,
+		logger:   logger,
+		debug:    debug,
+	}, nil
+}
+
+func (p *NsupdateProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("creating nsupdate record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	add, err := p.addCommand(domain, recordType, value)
+	if err != nil {
+		return err
+	}
+	if err := p.run(ctx, add); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("nsupdate record created successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *NsupdateProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("updating nsupdate record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	add, err := p.addCommand(domain, recordType, value)
+	if err != nil {
+		return err
+	}
+	// Both commands are sent as one update and applied atomically
+	if err := p.run(ctx, p.deleteCommand(domain, recordType), add); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("nsupdate record updated successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *NsupdateProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if err := p.checkDomain(domain); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("deleting nsupdate record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	// Deleting a missing RRset succeeds, no lookup needed
+	if err := p.run(ctx, p.deleteCommand(domain, recordType)); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("nsupdate record deleted successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *NsupdateProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if p.debug {
+		p.logger.Debug("searching nsupdate records", zap.String("domain", domain))
+	}
+
+	records, err := p.lookup.FindRecord(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("found nsupdate records", zap.String("domain", domain), zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *NsupdateProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating nsupdate setup", zap.String("nsupdate_path", p.nsupdate), zap.String("zone", p.zone))
+	}
+
+	if _, err := exec.LookPath(p.nsupdate); err != nil {
+		return fmt.Errorf("nsupdate not found: %w", err)
+	}
+	return p.lookup.Validate(ctx)
+}
+
+// addCommand returns the nsupdate command adding a record
+func (p *NsupdateProvider) addCommand(domain, recordType, value string) (string, error) {
+	if err := p.checkDomain(domain); err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("invalid %s record value for %s: contains a line break", recordType, domain)
+	}
+
+	switch recordType {
+	case "A", "AAAA", "SRV":
+	case "CNAME", "PTR":
+		value = dns.Fqdn(value)
+	case "TXT":
+		parts := splitTXT(value)
+		for i, part := range parts {
+			parts[i] = quoteTXT(part)
+		}
+		value = strings.Join(parts, " ")
+	default:
+		return "", ErrUnsupportedRecordType{RecordType: recordType, Backend: "the nsupdate provider"}
+	}
+	return fmt.Sprintf("update add %s %d IN %s %s", dns.Fqdn(domain), p.ttl, recordType, value), nil
+}
+
+// deleteCommand returns the nsupdate command deleting the RRset of domain and recordType
+func (p *NsupdateProvider) deleteCommand(domain, recordType string) string {
+	return fmt.Sprintf("update delete %s IN %s", dns.Fqdn(domain), recordType)
+}
+
+// checkDomain makes sure domain belongs to the configured zone and can't
+// inject commands
+func (p *NsupdateProvider) checkDomain(domain string) error {
+	if strings.ContainsAny(domain, " \t\r\n") {
+		return fmt.Errorf("invalid domain %q", domain)
+	}
+	if !inZone(domain, p.zone) {
+		return fmt.Errorf("domain %s is not part of zone %s", domain, p.zone)
+	}
+	return nil
+}
+
+// run sends commands to the server as a single update
+func (p *NsupdateProvider) run(ctx context.Context, commands ...string) error {
+	var script strings.Builder
+	fmt.Fprintf(&script, "server %s %s\n", p.host, p.port)
+	fmt.Fprintf(&script, "zone %s\n", p.zone)
+	for _, command := range commands {
+		script.WriteString(command + "\n")
+	}
+	script.WriteString("send\n")
+
+	// -v uses TCP like the RFC 2136 provider, -t bounds each request
+	args := []string{"-v", "-t", fmt.Sprint(int(p.timeout.Seconds()))}
+	if p.keyFile != "" {
+		args = append(args, "-k", p.keyFile)
+	}
+
+	if p.debug {
+		p.logger.Debug("running nsupdate",
+			zap.String("nsupdate_path", p.nsupdate),
+			zap.Strings("args", args),
+			zap.String("script", script.String()))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.nsupdate, args...)
+	cmd.Stdin = strings.NewReader(script.String())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if p.debug {
+			p.logger.Debug("nsupdate failed", zap.String("stdout", stdout.String()), zap.Error(err))
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("nsupdate failed: %w: %s", err, message)
+		}
+		return fmt.Errorf("nsupdate failed: %w", err)
+	}
+	return nil
+}
+
+// Interface compliance
+var _ DNSService = (*NsupdateProvider)(nil)
@@ -1,46 +1,47 @@
 package provider
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-// DNSService interface for different DNS backends
-type DNSService interface {
-	CreateRecord(domain, ip string) error
-	DeleteRecord(domain string) error
-	UpdateRecord(domain, ip string) error
-	FindRecord(domain string) (*DNSRecord, error)
-}
-
-// DNSRecord represents a DNS record
-type DNSRecord struct {
-	Domain      string
-	IP          string
-	RecordType  string
-	UUID        string
-	Enabled     bool
-	Description string
-}
-
 // OPNsenseProvider implements DNSService for OPNsense
 type OPNsenseProvider struct {
-	hostname   string
+	baseURL    string
 	apiKey     string
 	apiSecret  string
+	authMode   string // "basic", "header" or "query"
 	dnsService string
+	ttl        int
+	comment    string
 	client     *http.Client
 	logger     *zap.Logger
 	debug      bool
+
+	// reconfigureDelay debounces reconfigure calls, zero applies each change
+	reconfigureDelay time.Duration
+
+	// autoApply reconfigures the DNS service after changes, without it
+	// changes stay staged until applied in the OPNsense UI
+	autoApply bool
+
+	// reconfigure is deferred while batching or until the debounce timer fires
+	mu      sync.Mutex
+	batches int // open batches, they overlap with concurrent workers
+	dirty   bool
+	timer   *time.Timer
 }
 
 type unboundOverride struct {
@@ -64,12 +65,32 @@ type dnsmasqHost struct {
 	Description string `json:"descr"`
 }
 
-// NewOPNsenseProvider creates a new OPNsense provider
-func NewOPNsenseProvider(hostname, apiKey, apiSecret, dnsService string, insecure bool, logger *zap.Logger, debug bool) (*OPNsenseProvider, error) {
+// defaultOPNsenseComment is the description of created records
+const defaultOPNsenseComment = managedDescription
+
+// NewOPNsenseProvider creates a new OPNsense provider. hostname is a host
+// name with an optional port or a base URL such as https://fw.lan:10443/opnsense,
+// HTTPS is used unless another scheme is given. comment is the
+// description of created records, "{domain}" is replaced with the domain.
+// With a reconfigureDelay, the DNS service is reconfigured once no change
+// was made for that long instead of after every change. Without autoApply
+// it is never reconfigured, leaving changes staged for the operator.
+// Requests carry userAgent and headers, e.g. for an API gateway.
+// authMode selects how the key and secret are sent, see authenticate. pool
+// tunes the kept-alive connections to the API.
+func NewOPNsenseProvider(hostname, apiKey, apiSecret, authMode, dnsService string, ttl int, comment string, autoApply bool, reconfigureDelay, timeout time.Duration, tlsConfig *tls.Config, pool ConnPool, userAgent string, headers map[string]string, logger *zap.Logger, debug bool) (*OPNsenseProvider, error) {
 	if hostname == "" || apiKey == "" || apiSecret == "" {
 		return nil, errors.New("opnsense provider requires hostname, api_key, and api_secret")
 	}
 
+	// OPNsense itself expects basic auth
+	if authMode == "" {
+		authMode = "basic"
+	}
+	if authMode != "basic" && authMode != "header" && authMode != "query" {
+		return nil, fmt.Errorf("unsupported auth_mode: %s (must be 'basic', 'header' or 'query')", authMode)
+	}
+
 	// Default to unbound if dns_service not specified
 	if dnsService == "" {
 		dnsService = "unbound"
@@ -80,65 +101,113 @@ func NewOPNsenseProvider(hostname, apiKey, apiSecret, dnsService string, insecur
 		return nil, fmt.Errorf("unsupported dns_service: %s (must be 'unbound' or 'dnsmasq')", dnsService)
 	}
 
-	tr := &http.Transport{}
-	if insecure {
-		tr.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
-		if debug {
-			logger.Debug("OPNsense provider configured with insecure SSL", zap.String("hostname", hostname))
-		}
+	// dnsmasq host entries have no per-record TTL
+	if ttl > 0 && dnsService == "dnsmasq" {
+		logger.Warn("ttl is not supported by dnsmasq host entries and will be ignored", zap.String("hostname", hostname))
+	}
+
+	if comment == "" {
+		comment = defaultOPNsenseComment
 	}
 
+	baseURL, err := opnsenseBaseURL(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bursts of changes reuse the kept-alive connections
+	tr := newTransport(tlsConfig, pool)
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
 	client := &http.Client{
-		Timeout:   15 * time.Second,
-		Transport: tr,
+		Timeout:   timeout,
+		Transport: withHeaders(tr, userAgent, headers),
 	}
 
 	if debug {
 		logger.Debug("OPNsense provider created",
-			zap.String("hostname", hostname),
+			zap.String("base_url", baseURL),
+			zap.String("auth_mode", authMode),
 			zap.String("dns_service", dnsService),
-			zap.Bool("insecure", insecure))
+			zap.Int("ttl", ttl),
+			zap.String("comment", comment),
+			zap.Bool("auto_apply", autoApply),
+			zap.Duration("reconfigure_delay", reconfigureDelay),
+			zap.Duration("timeout", timeout),
+			zap.Bool("custom_tls", tlsConfig != nil),
+			zap.Int("max_idle_conns", tr.MaxIdleConnsPerHost),
+			zap.Duration("idle_conn_timeout", tr.IdleConnTimeout),
+			zap.Bool("keep_alives", !tr.DisableKeepAlives),
+			zap.Int("custom_headers", len(headers)))
 	}
 
 	return &OPNsenseProvider{
-		hostname:   hostname,
+		baseURL:    baseURL,
 		apiKey:     apiKey,
 		apiSecret:  apiSecret,
+		authMode:   authMode,
 		dnsService: dnsService,
+		ttl:        ttl,
+		comment:    comment,
 		client:     client,
-		logger:     logger,
-		debug:      debug,
+
+		reconfigureDelay: reconfigureDelay,
+		autoApply:        autoApply,
+		logger:           logger,
+		debug:            debug,
 	}, nil
 }
 
-func (p *OPNsenseProvider) CreateRecord(domain, ip string) error {
+// opnsenseBaseURL returns the URL the API paths are appended to
+func opnsenseBaseURL(hostname string) (string, error) {
+	if !strings.Contains(hostname, "://") {
+		hostname = "https://" + hostname
+	}
+	u, err := url.Parse(hostname)
+	if err != nil {
+		return "", fmt.Errorf("invalid hostname: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("invalid hostname %s: scheme must be http or https", hostname)
+	}
+	if u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid hostname %s: must be a host or a base URL without query", hostname)
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+func (p *OPNsenseProvider) CreateRecord(ctx context.Context, domain, recordType, ip string) error {
 	if !strings.Contains(domain, ".") {
 		return fmt.Errorf("domain must contain a dot: %s", domain)
 	}
+	// Host overrides and host entries only hold addresses
+	if recordType != "A" && recordType != "AAAA" {
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "OPNsense " + p.dnsService}
+	}
 
 	if p.debug {
 		p.logger.Debug("creating DNS record",
 			zap.String("domain", domain),
+			zap.String("record_type", recordType),
 			zap.String("ip", ip),
 			zap.String("provider_type", p.dnsService))
 	}
 
 	if p.dnsService == "dnsmasq" {
-		return p.createDnsmasqRecord(domain, ip)
+		// dnsmasq host entries cannot hold wildcards
+		if IsWildcard(domain) {
+			return fmt.Errorf("wildcard records are not supported by dnsmasq: %s", domain)
+		}
+		return p.createDnsmasqRecord(ctx, domain, ip)
 	}
 
 	// Default to unbound
-	return p.createUnboundRecord(domain, ip)
+	return p.createUnboundRecord(ctx, domain, recordType, ip)
 }
 
-func (p *OPNsenseProvider) createUnboundRecord(domain, ip string) error {
-	recordType := "A"
-	if parsedIP := net.ParseIP(ip); parsedIP != nil && parsedIP.To4() == nil {
-		recordType = "AAAA"
-	}
-
+func (p *OPNsenseProvider) createUnboundRecord(ctx context.Context, domain, recordType, ip string) error {
 	host := domain[:strings.IndexByte(domain, '.')]
 	zone := domain[strings.IndexByte(domain, '.')+1:]
 
@@ -147,46 +216,88 @@ func (p *OPNsenseProvider) createUnboundRecord(domain, ip string) error {
 			zap.String("host", host),
 			zap.String("zone", zone),
 			zap.String("record_type", recordType),
-			zap.String("ip", ip))
+			zap.String("ip", ip),
+			zap.Int("ttl", p.ttl))
 	}
 
-	payload := map[string]any{
-		"host": map[string]any{
-			"enabled":     "1",
-			"hostname":    host,
-			"domain":      zone,
-			"rr":          recordType,
-			"mxprio":      "",
-			"mx":          "",
-			"server":      ip,
-			"description": "Generated by Caddy Local DNS",
-		},
-	}
+	payload := map[string]any{"host": p.hostOverride(ctx, domain, recordType, ip)}
 
-	resp, err := p.apiCall("unbound/settings/add_host_override", payload)
+	resp, err := p.apiCall(ctx, "unbound/settings/add_host_override", payload)
 	if err != nil {
 		return err
 	}
 
 	var res struct {
 		Result string `json:"result"`
+		UUID   string `json:"uuid"`
 	}
 	if err := json.Unmarshal(resp, &res); err != nil {
 		return err
 	}
 	if res.Result != "saved" {
-		return fmt.Errorf("add_override failed: %s", string(resp))
+		return fmt.Errorf("add_override failed: %w", resultError(res.Result, resp))
 	}
+	setRecordID(ctx, res.UUID)
 
 	if p.debug {
-		p.logger.Debug("unbound record created successfully", zap.String("domain", domain))
+		p.logger.Debug("unbound record created successfully", zap.String("domain", domain), zap.String("uuid", res.UUID))
 	}
 
 	// Reload config
-	return p.reconfigure()
+	return p.apply(ctx)
+}
+
+// updateUnboundRecord changes the first of the existing host overrides in
+// place, so its UUID stays the same, and deletes any duplicates
+func (p *OPNsenseProvider) updateUnboundRecord(ctx context.Context, domain, recordType, ip string, existing []*DNSRecord) error {
+	uuid := existing[0].UUID
+	if p.debug {
+		p.logger.Debug("updating unbound record", zap.String("domain", domain), zap.String("uuid", uuid), zap.String("ip", ip))
+	}
+
+	payload := map[string]any{"host": p.hostOverride(ctx, domain, recordType, ip)}
+	resp, err := p.apiCall(ctx, "unbound/settings/set_host_override/"+uuid, payload)
+	if err != nil {
+		return err
+	}
+	if err := checkResult(resp, "saved"); err != nil {
+		return fmt.Errorf("set_host_override failed: %w", err)
+	}
+
+	for _, record := range existing[1:] {
+		resp, err := p.apiCall(ctx, "unbound/settings/del_host_override/"+record.UUID, nil)
+		if err != nil {
+			return err
+		}
+		if err := checkResult(resp, "deleted"); err != nil {
+			return fmt.Errorf("del_host_override failed: %w", err)
+		}
+	}
+	setRecordID(ctx, uuid)
+
+	return p.apply(ctx)
 }
 
-func (p *OPNsenseProvider) createDnsmasqRecord(domain, ip string) error {
+// hostOverride returns the settings of an enabled host override
+func (p *OPNsenseProvider) hostOverride(ctx context.Context, domain, recordType, ip string) map[string]any {
+	override := map[string]any{
+		"enabled":     "1",
+		"hostname":    domain[:strings.IndexByte(domain, '.')],
+		"domain":      domain[strings.IndexByte(domain, '.')+1:],
+		"rr":          recordType,
+		"mxprio":      "",
+		"mx":          "",
+		"server":      ip,
+		"description": recordDescription(ctx, p.description(domain)),
+	}
+	// Leave ttl unset to keep Unbound's default
+	if p.ttl > 0 {
+		override["ttl"] = strconv.Itoa(p.ttl)
+	}
+	return override
+}
+
+func (p *OPNsenseProvider) createDnsmasqRecord(ctx context.Context, domain, ip string) error {
 	host := domain[:strings.IndexByte(domain, '.')]
 	zone := domain[strings.IndexByte(domain, '.')+1:]
 
@@ -202,73 +313,93 @@ func (p *OPNsenseProvider) createDnsmasqRecord(domain, ip string) error {
 			"host":   host,
 			"domain": zone,
 			"ip":     ip,
-			"descr":  "Generated by Caddy Local DNS",
+			"descr":  recordDescription(ctx, p.description(domain)),
 		},
 	}
 
-	resp, err := p.apiCall("dnsmasq/settings/add_host", payload)
+	resp, err := p.apiCall(ctx, "dnsmasq/settings/add_host", payload)
 	if err != nil {
 		return err
 	}
 
 	var res struct {
 		Result string `json:"result"`
+		UUID   string `json:"uuid"`
 	}
 	if err := json.Unmarshal(resp, &res); err != nil {
 		return err
 	}
 	if res.Result != "saved" {
-		return fmt.Errorf("add_host failed: %s", string(resp))
+		return fmt.Errorf("add_host failed: %w", resultError(res.Result, resp))
 	}
+	setRecordID(ctx, res.UUID)
 
 	if p.debug {
-		p.logger.Debug("dnsmasq record created successfully", zap.String("domain", domain))
+		p.logger.Debug("dnsmasq record created successfully", zap.String("domain", domain), zap.String("uuid", res.UUID))
 	}
 
 	// Reload config
-	return p.reconfigure()
+	return p.apply(ctx)
+}
+
+// description expands the comment template for domain
+func (p *OPNsenseProvider) description(domain string) string {
+	return strings.ReplaceAll(p.comment, "{domain}", domain)
 }
 
-func (p *OPNsenseProvider) UpdateRecord(domain, ip string) error {
+func (p *OPNsenseProvider) UpdateRecord(ctx context.Context, domain, recordType, ip string) error {
 	if p.debug {
-		p.logger.Debug("updating DNS record", zap.String("domain", domain), zap.String("ip", ip))
+		p.logger.Debug("updating DNS record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("ip", ip))
 	}
 
-	// Find existing record
-	existing, err := p.FindRecord(domain)
+	// Find existing records of the same type
+	records, err := p.FindRecord(ctx, domain)
 	if err != nil {
 		return err
 	}
-	if existing == nil {
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
 		p.logger.Info("record not found during update, creating new one", zap.String("domain", domain))
-		return p.CreateRecord(domain, ip)
+		return p.CreateRecord(ctx, domain, recordType, ip)
+	}
+
+	// Host overrides are addressed by UUID, dnsmasq hosts may hold both
+	// families and are replaced
+	if p.dnsService != "dnsmasq" {
+		return p.updateUnboundRecord(ctx, domain, recordType, ip, existing)
 	}
 
 	if p.debug {
-		p.logger.Debug("deleting existing record before update",
+		p.logger.Debug("deleting existing records before update",
 			zap.String("domain", domain),
-			zap.String("uuid", existing.UUID))
+			zap.String("record_type", recordType))
 	}
 
-	// Delete old record
-	if err := p.DeleteRecord(domain); err != nil {
+	// Delete old records
+	if err := p.DeleteRecord(ctx, domain, recordType); err != nil {
 		return err
 	}
 
 	// Create new record
-	return p.CreateRecord(domain, ip)
+	return p.CreateRecord(ctx, domain, recordType, ip)
 }
 
-func (p *OPNsenseProvider) DeleteRecord(domain string) error {
+func (p *OPNsenseProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
 	if p.debug {
-		p.logger.Debug("deleting DNS record", zap.String("domain", domain))
+		p.logger.Debug("deleting DNS record", zap.String("domain", domain), zap.String("record_type", recordType))
 	}
 
-	existing, err := p.FindRecord(domain)
+	var count int
+	var err error
+	if p.dnsService == "dnsmasq" {
+		count, err = p.deleteDnsmasqRecords(ctx, domain, recordType)
+	} else {
+		count, err = p.deleteUnboundRecords(ctx, domain, recordType)
+	}
 	if err != nil {
 		return err
 	}
-	if existing == nil {
+	if count == 0 {
 		if p.debug {
 			p.logger.Debug("record not found, nothing to delete", zap.String("domain", domain))
 		}
@@ -276,60 +407,194 @@ func (p *OPNsenseProvider) DeleteRecord(domain string) error {
 	}
 
 	if p.debug {
-		p.logger.Debug("found record to delete",
-			zap.String("domain", domain),
-			zap.String("uuid", existing.UUID))
+		p.logger.Debug("record deleted successfully", zap.String("domain", domain), zap.Int("count", count))
 	}
 
-	var endpoint string
+	return p.apply(ctx)
+}
+
+// SetEnabled toggles the host overrides of domain, dnsmasq hosts can't be disabled
+func (p *OPNsenseProvider) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
 	if p.dnsService == "dnsmasq" {
-		endpoint = "dnsmasq/settings/del_domain/" + existing.UUID
-	} else {
-		endpoint = "unbound/settings/del_host_override/" + existing.UUID
+		return ErrToggleUnsupported
 	}
 
-	resp, err := p.apiCall(endpoint, nil)
+	if p.debug {
+		p.logger.Debug("toggling DNS record", zap.String("domain", domain), zap.String("record_type", recordType), zap.Bool("enabled", enabled))
+	}
+
+	records, err := p.findUnboundRecords(ctx, domain)
 	if err != nil {
 		return err
 	}
 
+	state := "0"
+	if enabled {
+		state = "1"
+	}
+	var changed bool
+	for _, record := range filterRecords(records, recordType) {
+		if record.Enabled == enabled {
+			continue
+		}
+		resp, err := p.apiCall(ctx, "unbound/settings/toggle_host_override/"+record.UUID+"/"+state, nil)
+		if err != nil {
+			return err
+		}
+		var res struct {
+			Result string `json:"result"`
+		}
+		if err := json.Unmarshal(resp, &res); err != nil {
+			return err
+		}
+		if res.Result == "failed" {
+			return fmt.Errorf("toggle_host_override failed: %w", resultError(res.Result, resp))
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return p.apply(ctx)
+}
+
+// deleteUnboundRecords deletes the host overrides of domain with recordType
+func (p *OPNsenseProvider) deleteUnboundRecords(ctx context.Context, domain, recordType string) (int, error) {
+	records, err := p.findUnboundRecords(ctx, domain)
+	if err != nil {
+		return 0, err
+	}
+	existing := filterRecords(records, recordType)
+
+	for _, record := range existing {
+		if p.debug {
+			p.logger.Debug("found record to delete",
+				zap.String("domain", domain),
+				zap.String("uuid", record.UUID))
+		}
+
+		resp, err := p.apiCall(ctx, "unbound/settings/del_host_override/"+record.UUID, nil)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkResult(resp, "deleted"); err != nil {
+			return 0, fmt.Errorf("del_host_override failed: %w", err)
+		}
+	}
+	return len(existing), nil
+}
+
+// deleteDnsmasqRecords removes the addresses of recordType from the host
+// entries of domain. A host entry may hold addresses of both families, such
+// entries are updated and only deleted once no address is left.
+func (p *OPNsenseProvider) deleteDnsmasqRecords(ctx context.Context, domain, recordType string) (int, error) {
+	rows, err := p.dnsmasqHosts(ctx, domain)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, row := range rows {
+		var kept []string
+		var removed bool
+		for _, ip := range splitDnsmasqIPs(row.IP) {
+			if RecordTypeForIP(ip) == recordType {
+				removed = true
+			} else {
+				kept = append(kept, ip)
+			}
+		}
+		if !removed {
+			continue
+		}
+		count++
+
+		if p.debug {
+			p.logger.Debug("found record to delete",
+				zap.String("domain", domain),
+				zap.String("uuid", row.UUID),
+				zap.Strings("remaining", kept))
+		}
+
+		if len(kept) == 0 {
+			resp, err := p.apiCall(ctx, "dnsmasq/settings/del_host/"+row.UUID, nil)
+			if err != nil {
+				return 0, err
+			}
+			if err := checkResult(resp, "deleted"); err != nil {
+				return 0, fmt.Errorf("del_host failed: %w", err)
+			}
+			continue
+		}
+
+		payload := map[string]any{
+			"host": map[string]any{
+				"host":   row.Host,
+				"domain": row.Domain,
+				"ip":     strings.Join(kept, ","),
+				"descr":  row.Description,
+			},
+		}
+		resp, err := p.apiCall(ctx, "dnsmasq/settings/set_host/"+row.UUID, payload)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkResult(resp, "saved"); err != nil {
+			return 0, fmt.Errorf("set_host failed: %w", err)
+		}
+	}
+	return count, nil
+}
+
+// checkResult verifies the "result" field of a settings API response
+func checkResult(resp []byte, want string) error {
 	var res struct {
 		Result string `json:"result"`
 	}
 	if err := json.Unmarshal(resp, &res); err != nil {
 		return err
 	}
-	if res.Result != "deleted" {
-		return fmt.Errorf("delete_record failed: %s", string(resp))
+	if res.Result != want {
+		return resultError(res.Result, resp)
 	}
+	return nil
+}
 
-	if p.debug {
-		p.logger.Debug("record deleted successfully", zap.String("domain", domain))
+// resultError returns the error of a settings API response with an
+// unexpected result. Unknown UUIDs are "not found", failed validations
+// "failed".
+func resultError(result string, resp []byte) error {
+	switch result {
+	case "not found":
+		return fmt.Errorf("%w: %s", ErrNotFound, string(resp))
+	case "failed":
+		return fmt.Errorf("%w: %s", ErrConflict, string(resp))
+	default:
+		return errors.New(string(resp))
 	}
-
-	return p.reconfigure()
 }
 
-func (p *OPNsenseProvider) FindRecord(domain string) (*DNSRecord, error) {
+func (p *OPNsenseProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
 	if !strings.Contains(domain, ".") {
 		return nil, fmt.Errorf("domain must contain a dot: %s", domain)
 	}
 
 	if p.debug {
-		p.logger.Debug("searching for DNS record",
+		p.logger.Debug("searching for DNS records",
 			zap.String("domain", domain),
 			zap.String("provider_type", p.dnsService))
 	}
 
 	if p.dnsService == "dnsmasq" {
-		return p.findDnsmasqRecord(domain)
+		return p.findDnsmasqRecords(ctx, domain)
 	}
 
 	// Default to unbound
-	return p.findUnboundRecord(domain)
+	return p.findUnboundRecords(ctx, domain)
 }
 
-func (p *OPNsenseProvider) findUnboundRecord(domain string) (*DNSRecord, error) {
+func (p *OPNsenseProvider) findUnboundRecords(ctx context.Context, domain string) ([]*DNSRecord, error) {
 	host := domain[:strings.IndexByte(domain, '.')]
 	zone := domain[strings.IndexByte(domain, '.')+1:]
 
@@ -339,7 +604,7 @@ func (p *OPNsenseProvider) findUnboundRecord(domain string) (*DNSRecord, error)
 			zap.String("zone", zone))
 	}
 
-	resp, err := p.apiCall("unbound/settings/search_host_override", nil)
+	resp, err := p.apiCall(ctx, "unbound/settings/search_host_override", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -355,38 +620,75 @@ func (p *OPNsenseProvider) findUnboundRecord(domain string) (*DNSRecord, error)
 		p.logger.Debug("found unbound records", zap.Int("count", len(data.Rows)))
 	}
 
+	var records []*DNSRecord
 	for _, row := range data.Rows {
-		if row.Hostname == host && row.Domain == zone {
-			// Extract just the record type (e.g., "A" from "A (IPv4 Address)")
-			recordType := strings.SplitN(strings.TrimSpace(row.RR), " ", 2)[0]
+		if row.Hostname != host || row.Domain != zone {
+			continue
+		}
+
+		// Extract just the record type (e.g., "A" from "A (IPv4 Address)")
+		recordType := strings.SplitN(strings.TrimSpace(row.RR), " ", 2)[0]
+
+		if p.debug {
+			p.logger.Debug("found matching unbound record",
+				zap.String("domain", domain),
+				zap.String("uuid", row.UUID),
+				zap.String("ip", row.Server),
+				zap.String("enabled", row.Enabled),
+				zap.String("raw_rr", row.RR),
+				zap.String("parsed_record_type", recordType))
+		}
+		records = append(records, &DNSRecord{
+			Domain:      domain,
+			Value:       row.Server,
+			RecordType:  recordType,
+			UUID:        row.UUID,
+			Enabled:     row.Enabled == "1",
+			Description: row.Description,
+		})
+	}
 
+	if p.debug && len(records) == 0 {
+		p.logger.Debug("no matching unbound record found", zap.String("domain", domain))
+	}
+	return records, nil
+}
+
+func (p *OPNsenseProvider) findDnsmasqRecords(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	rows, err := p.dnsmasqHosts(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, row := range rows {
+		// A host entry lists all of its addresses in one comma-separated field
+		for _, ip := range splitDnsmasqIPs(row.IP) {
 			if p.debug {
-				p.logger.Debug("found matching unbound record",
+				p.logger.Debug("found matching dnsmasq record",
 					zap.String("domain", domain),
 					zap.String("uuid", row.UUID),
-					zap.String("ip", row.Server),
-					zap.String("enabled", row.Enabled),
-					zap.String("raw_rr", row.RR),
-					zap.String("parsed_record_type", recordType))
+					zap.String("ip", ip))
 			}
-			return &DNSRecord{
+			records = append(records, &DNSRecord{
 				Domain:      domain,
-				IP:          row.Server,
-				RecordType:  recordType,
+				Value:       ip,
+				RecordType:  RecordTypeForIP(ip), // dnsmasq doesn't specify record type explicitly
 				UUID:        row.UUID,
-				Enabled:     row.Enabled == "1",
+				Enabled:     true, // dnsmasq hosts are always enabled
 				Description: row.Description,
-			}, nil
+			})
 		}
 	}
 
-	if p.debug {
-		p.logger.Debug("no matching unbound record found", zap.String("domain", domain))
+	if p.debug && len(records) == 0 {
+		p.logger.Debug("no matching dnsmasq record found", zap.String("domain", domain))
 	}
-	return nil, nil
+	return records, nil
 }
 
-func (p *OPNsenseProvider) findDnsmasqRecord(domain string) (*DNSRecord, error) {
+// dnsmasqHosts returns the host entries of domain
+func (p *OPNsenseProvider) dnsmasqHosts(ctx context.Context, domain string) ([]dnsmasqHost, error) {
 	host := domain[:strings.IndexByte(domain, '.')]
 	zone := domain[strings.IndexByte(domain, '.')+1:]
 
@@ -396,7 +698,7 @@ func (p *OPNsenseProvider) findDnsmasqRecord(domain string) (*DNSRecord, error)
 			zap.String("zone", zone))
 	}
 
-	resp, err := p.apiCall("dnsmasq/settings/search_host", nil)
+	resp, err := p.apiCall(ctx, "dnsmasq/settings/search_host", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -412,32 +714,207 @@ func (p *OPNsenseProvider) findDnsmasqRecord(domain string) (*DNSRecord, error)
 		p.logger.Debug("found dnsmasq records", zap.Int("count", len(data.Rows)))
 	}
 
+	var rows []dnsmasqHost
 	for _, row := range data.Rows {
 		if row.Host == host && row.Domain == zone {
-			if p.debug {
-				p.logger.Debug("found matching dnsmasq record",
-					zap.String("domain", domain),
-					zap.String("uuid", row.UUID),
-					zap.String("ip", row.IP))
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// splitDnsmasqIPs splits the comma-separated address list of a host entry
+func splitDnsmasqIPs(ips string) []string {
+	var out []string
+	for _, ip := range strings.Split(ips, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			out = append(out, ip)
+		}
+	}
+	return out
+}
+
+// ListRecords returns the records whose description matches the comment
+func (p *OPNsenseProvider) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	if p.debug {
+		p.logger.Debug("listing managed DNS records", zap.String("provider_type", p.dnsService))
+	}
+
+	var records []*DNSRecord
+	if p.dnsService == "dnsmasq" {
+		resp, err := p.apiCall(ctx, "dnsmasq/settings/search_host", nil)
+		if err != nil {
+			return nil, err
+		}
+		var data struct {
+			Rows []dnsmasqHost `json:"rows"`
+		}
+		if err := json.Unmarshal(resp, &data); err != nil {
+			return nil, err
+		}
+
+		for _, row := range data.Rows {
+			domain := row.Host + "." + row.Domain
+			if row.Host == "" || !isManaged(row.Description, p.description(domain)) {
+				continue
+			}
+			for _, ip := range splitDnsmasqIPs(row.IP) {
+				records = append(records, &DNSRecord{
+					Domain:      domain,
+					Value:       ip,
+					RecordType:  RecordTypeForIP(ip),
+					UUID:        row.UUID,
+					Enabled:     true,
+					Description: row.Description,
+				})
 			}
-			return &DNSRecord{
+		}
+	} else {
+		resp, err := p.apiCall(ctx, "unbound/settings/search_host_override", nil)
+		if err != nil {
+			return nil, err
+		}
+		var data struct {
+			Rows []unboundOverride `json:"rows"`
+		}
+		if err := json.Unmarshal(resp, &data); err != nil {
+			return nil, err
+		}
+
+		for _, row := range data.Rows {
+			domain := row.Hostname + "." + row.Domain
+			if row.Hostname == "" || !isManaged(row.Description, p.description(domain)) {
+				continue
+			}
+			records = append(records, &DNSRecord{
 				Domain:      domain,
-				IP:          row.IP,
-				RecordType:  "A", // dnsmasq doesn't specify record type explicitly
+				Value:       row.Server,
+				RecordType:  strings.SplitN(strings.TrimSpace(row.RR), " ", 2)[0],
 				UUID:        row.UUID,
-				Enabled:     true, // dnsmasq hosts are always enabled
+				Enabled:     row.Enabled == "1",
 				Description: row.Description,
-			}, nil
+			})
 		}
 	}
 
 	if p.debug {
-		p.logger.Debug("no matching dnsmasq record found", zap.String("domain", domain))
+		p.logger.Debug("found managed DNS records", zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *OPNsenseProvider) Validate(ctx context.Context) error {
+	// Listing records is cheap and needs the same privileges as managing them
+	endpoint := "unbound/settings/search_host_override"
+	if p.dnsService == "dnsmasq" {
+		endpoint = "dnsmasq/settings/search_host"
+	}
+
+	if p.debug {
+		p.logger.Debug("validating OPNsense connectivity", zap.String("endpoint", endpoint))
+	}
+
+	resp, err := p.apiCall(ctx, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	var data struct {
+		Rows json.RawMessage `json:"rows"`
+	}
+	if err := json.Unmarshal(resp, &data); err != nil || data.Rows == nil {
+		return fmt.Errorf("unexpected response from %s: %s", endpoint, string(resp))
+	}
+	return nil
+}
+
+func (p *OPNsenseProvider) BeginBatch() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches++
+}
+
+func (p *OPNsenseProvider) EndBatch() error {
+	p.mu.Lock()
+	if p.batches > 0 {
+		p.batches--
+	}
+	// The last open batch applies the changes of all of them
+	dirty := p.dirty && p.batches == 0
+	if dirty {
+		p.dirty = false
+	}
+	p.mu.Unlock()
+
+	if !dirty {
+		return nil
+	}
+	// Batches span several requests, only the client timeout applies
+	return p.apply(context.Background())
+}
+
+func (p *OPNsenseProvider) Flush() error {
+	p.mu.Lock()
+	dirty := p.dirty
+	p.dirty = false
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.mu.Unlock()
+
+	if !dirty {
+		return nil
+	}
+	return p.reconfigure(context.Background())
+}
+
+// apply reconfigures the DNS service unless a batch or the debounce delay
+// defers it, or auto apply is disabled
+func (p *OPNsenseProvider) apply(ctx context.Context) error {
+	if !p.autoApply {
+		if p.debug {
+			p.logger.Debug("auto apply disabled, leaving changes staged", zap.String("service", p.dnsService))
+		}
+		return nil
+	}
+
+	p.mu.Lock()
+	switch {
+	case p.batches > 0:
+		p.dirty = true
+		p.mu.Unlock()
+		return nil
+	case p.reconfigureDelay > 0:
+		p.dirty = true
+		if p.timer == nil {
+			p.timer = time.AfterFunc(p.reconfigureDelay, p.debounced)
+		} else {
+			p.timer.Reset(p.reconfigureDelay)
+		}
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.Unlock()
+
+	return p.reconfigure(ctx)
+}
+
+// debounced runs the deferred reconfigure once the debounce delay has passed
+func (p *OPNsenseProvider) debounced() {
+	p.mu.Lock()
+	// An open batch applies the change when it ends
+	if p.batches > 0 || !p.dirty {
+		p.mu.Unlock()
+		return
+	}
+	p.dirty = false
+	p.mu.Unlock()
+
+	if err := p.reconfigure(context.Background()); err != nil {
+		p.logger.Error("deferred reconfigure failed", zap.String("service", p.dnsService), zap.Error(err))
 	}
-	return nil, nil
 }
 
-func (p *OPNsenseProvider) reconfigure() error {
+func (p *OPNsenseProvider) reconfigure(ctx context.Context) error {
 	var endpoint string
 	if p.dnsService == "dnsmasq" {
 		endpoint = "dnsmasq/service/reconfigure"
@@ -449,7 +926,7 @@ func (p *OPNsenseProvider) reconfigure() error {
 		p.logger.Debug("reconfiguring DNS service", zap.String("service", p.dnsService))
 	}
 
-	resp, err := p.apiCall(endpoint, nil)
+	resp, err := p.apiCall(ctx, endpoint, nil)
 	if err != nil {
 		return err
 	}
@@ -469,9 +946,27 @@ func (p *OPNsenseProvider) reconfigure() error {
 	return nil
 }
 
-func (p *OPNsenseProvider) apiCall(endpoint string, payload any) ([]byte, error) {
+// authenticate adds the credentials to req: as basic auth, as X-API-Key and
+// X-API-Secret headers, or as key and secret query parameters for proxies
+// in front of the API that authenticate the request themselves
+func (p *OPNsenseProvider) authenticate(req *http.Request) {
+	switch p.authMode {
+	case "header":
+		req.Header.Set("X-API-Key", p.apiKey)
+		req.Header.Set("X-API-Secret", p.apiSecret)
+	case "query":
+		query := req.URL.Query()
+		query.Set("key", p.apiKey)
+		query.Set("secret", p.apiSecret)
+		req.URL.RawQuery = query.Encode()
+	default:
+		req.SetBasicAuth(p.apiKey, p.apiSecret)
+	}
+}
+
+func (p *OPNsenseProvider) apiCall(ctx context.Context, endpoint string, payload any) ([]byte, error) {
 	// endpoint already includes the full path like "dnsmasq/settings/add_host" or "unbound/settings/add_host_override"
-	url := fmt.Sprintf("https://%s/api/%s", p.hostname, endpoint)
+	url := fmt.Sprintf("%s/api/%s", p.baseURL, endpoint)
 
 	if p.debug {
 		p.logger.Debug("making API call",
@@ -488,11 +983,11 @@ func (p *OPNsenseProvider) apiCall(endpoint string, payload any) ([]byte, error)
 			p.logger.Debug("API call payload", zap.String("payload", string(data)))
 		}
 	}
-	req, err := http.NewRequest("POST", url, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(p.apiKey, p.apiSecret)
+	p.authenticate(req)
 	if payload != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -503,9 +998,12 @@ func (p *OPNsenseProvider) apiCall(endpoint string, payload any) ([]byte, error)
 		}
 		// Check for common SSL errors like in the shell script
 		if strings.Contains(err.Error(), "certificate") || strings.Contains(err.Error(), "tls") {
-			return nil, fmt.Errorf("SSL/TLS error connecting to OPNsense API. If using self-signed certificates, enable 'insecure' option: %w", err)
+			return nil, fmt.Errorf("SSL/TLS error connecting to OPNsense API. If using self-signed certificates, set 'ca_cert' or enable 'insecure' option: %w", err)
 		}
-		return nil, err
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 	out, err := io.ReadAll(resp.Body)
@@ -520,10 +1018,15 @@ func (p *OPNsenseProvider) apiCall(endpoint string, payload any) ([]byte, error)
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, string(out))
+		return nil, statusError(resp.StatusCode, out)
 	}
 	return out, nil
 }
 
 // Interface compliance
-var _ DNSService = (*OPNsenseProvider)(nil)
+var (
+	_ DNSService = (*OPNsenseProvider)(nil)
+	_ Batcher    = (*OPNsenseProvider)(nil)
+	_ Toggler    = (*OPNsenseProvider)(nil)
+	_ Lister     = (*OPNsenseProvider)(nil)
+)
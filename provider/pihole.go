@@ -0,0 +1,321 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PiholeProvider implements DNSService for Pi-hole (v5 customdns/customcname API)
+type PiholeProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+	logger  *zap.Logger
+	debug   bool
+}
+
+// piholeResponse is the generic response of add/delete actions
+type piholeResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// NewPiholeProvider creates a new Pi-hole provider
+func NewPiholeProvider(hostname, apiKey string, ttl int, timeout time.Duration, tlsConfig *tls.Config, logger *zap.Logger, debug bool) (*PiholeProvider, error) {
+	if hostname == "" || apiKey == "" {
+		return nil, errors.New("pihole provider requires hostname and api_key")
+	}
+
+	// customdns entries are served with Pi-hole's global local-ttl
+	if ttl > 0 {
+		logger.Warn("ttl is not supported by Pi-hole custom DNS records and will be ignored", zap.String("hostname", hostname))
+	}
+
+	// Pi-hole serves plain HTTP by default, allow an explicit scheme in hostname
+	baseURL := hostname
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	// A nil tlsConfig keeps the default verification
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+	}
+
+	if debug {
+		logger.Debug("Pi-hole provider created",
+			zap.String("base_url", baseURL),
+			zap.Duration("timeout", timeout),
+			zap.Bool("custom_tls", tlsConfig != nil))
+	}
+
+	return &PiholeProvider{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		client:  client,
+		logger:  logger,
+		debug:   debug,
+	}, nil
+}
+
+func (p *PiholeProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if !strings.Contains(domain, ".") {
+		return fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+	if IsWildcard(domain) {
+		return fmt.Errorf("wildcard records are not supported by Pi-hole: %s", domain)
+	}
+
+	if p.debug {
+		p.logger.Debug("creating Pi-hole record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	if err := p.recordAction(ctx, "add", domain, recordType, value); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("Pi-hole record created successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *PiholeProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("updating Pi-hole record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		p.logger.Info("record not found during update, creating new one", zap.String("domain", domain))
+		return p.CreateRecord(ctx, domain, recordType, value)
+	}
+
+	// Pi-hole has no update action, entries are keyed by domain and value
+	for _, record := range existing {
+		if err := p.recordAction(ctx, "delete", domain, recordType, record.Value); err != nil {
+			return err
+		}
+	}
+
+	return p.CreateRecord(ctx, domain, recordType, value)
+}
+
+func (p *PiholeProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting Pi-hole record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		if p.debug {
+			p.logger.Debug("record not found, nothing to delete", zap.String("domain", domain))
+		}
+		return nil // Already deleted
+	}
+
+	for _, record := range existing {
+		if err := p.recordAction(ctx, "delete", domain, recordType, record.Value); err != nil {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("Pi-hole record deleted successfully", zap.String("domain", domain), zap.Int("count", len(existing)))
+	}
+	return nil
+}
+
+func (p *PiholeProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if !strings.Contains(domain, ".") {
+		return nil, fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+
+	if p.debug {
+		p.logger.Debug("searching Pi-hole records", zap.String("domain", domain))
+	}
+
+	var records []*DNSRecord
+	for _, list := range []string{"customdns", "customcname"} {
+		entries, err := p.listEntries(ctx, list)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.debug {
+			p.logger.Debug("found Pi-hole records", zap.String("list", list), zap.Int("count", len(entries)))
+		}
+
+		for _, entry := range entries {
+			if len(entry) < 2 || !strings.EqualFold(entry[0], domain) {
+				continue
+			}
+
+			// customdns doesn't specify record type explicitly, derive it from the IP
+			recordType := "CNAME"
+			if list == "customdns" {
+				recordType = RecordTypeForIP(entry[1])
+			}
+
+			if p.debug {
+				p.logger.Debug("found matching Pi-hole record",
+					zap.String("domain", domain),
+					zap.String("record_type", recordType),
+					zap.String("value", entry[1]))
+			}
+			records = append(records, &DNSRecord{
+				Domain:     domain,
+				Value:      entry[1],
+				RecordType: recordType,
+				Enabled:    true,
+			})
+		}
+	}
+
+	if p.debug && len(records) == 0 {
+		p.logger.Debug("no matching Pi-hole record found", zap.String("domain", domain))
+	}
+	return records, nil
+}
+
+func (p *PiholeProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating Pi-hole connectivity", zap.String("base_url", p.baseURL))
+	}
+
+	resp, err := p.apiCall(ctx, "customdns", url.Values{"action": {"get"}})
+	if err != nil {
+		return err
+	}
+	// An invalid token yields an empty array instead of a data object
+	var data struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &data); err != nil || data.Data == nil {
+		return fmt.Errorf("unexpected response from Pi-hole, check api_key: %s", string(resp))
+	}
+	return nil
+}
+
+// listEntries returns the [domain, value] pairs of a customdns or customcname list
+func (p *PiholeProvider) listEntries(ctx context.Context, list string) ([][]string, error) {
+	resp, err := p.apiCall(ctx, list, url.Values{"action": {"get"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Data [][]string `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &data); err != nil {
+		return nil, err
+	}
+	return data.Data, nil
+}
+
+// recordAction adds or deletes a local DNS record (A/AAAA) or CNAME record
+func (p *PiholeProvider) recordAction(ctx context.Context, action, domain, recordType, value string) error {
+	list := "customdns"
+	params := url.Values{
+		"action": {action},
+		"domain": {domain},
+	}
+	switch recordType {
+	case "A", "AAAA":
+		params.Set("ip", value)
+	case "CNAME":
+		list = "customcname"
+		params.Set("target", value)
+	default:
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "Pi-hole"}
+	}
+
+	resp, err := p.apiCall(ctx, list, params)
+	if err != nil {
+		return err
+	}
+
+	var res piholeResponse
+	if err := json.Unmarshal(resp, &res); err != nil {
+		return err
+	}
+	if !res.Success {
+		return fmt.Errorf("%s %s failed: %s", list, action, res.Message)
+	}
+	return nil
+}
+
+func (p *PiholeProvider) apiCall(ctx context.Context, list string, params url.Values) ([]byte, error) {
+	params.Set(list, "")
+	params.Set("auth", p.apiKey)
+	endpoint := fmt.Sprintf("%s/admin/api.php?%s", p.baseURL, params.Encode())
+
+	if p.debug {
+		p.logger.Debug("making API call",
+			zap.String("url", p.baseURL+"/admin/api.php"),
+			zap.String("list", list),
+			zap.String("action", params.Get("action")))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.debug {
+			p.logger.Debug("API call failed", zap.Error(err))
+		}
+		if strings.Contains(err.Error(), "certificate") || strings.Contains(err.Error(), "tls") {
+			return nil, fmt.Errorf("SSL/TLS error connecting to Pi-hole API. If using self-signed certificates, set 'ca_cert' or enable 'insecure' option: %w", err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("API call response",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(out)))
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, string(out))
+	}
+	return out, nil
+}
+
+// Interface compliance
+var _ DNSService = (*PiholeProvider)(nil)
@@ -0,0 +1,447 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PowerDNSProvider implements DNSService for the PowerDNS Authoritative HTTP API
+type PowerDNSProvider struct {
+	baseURL string
+	apiKey  string
+	zone    string // canonical, with trailing dot
+	ttl     int
+	client  *http.Client
+	logger  *zap.Logger
+	debug   bool
+}
+
+// powerDNSRRset is a resource record set as used by the zones API
+type powerDNSRRset struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	TTL        int               `json:"ttl,omitempty"`
+	ChangeType string            `json:"changetype,omitempty"`
+	Records    []powerDNSRecord  `json:"records"`
+	Comments   []powerDNSComment `json:"comments,omitempty"`
+}
+
+type powerDNSRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type powerDNSComment struct {
+	Content string `json:"content"`
+	Account string `json:"account"`
+}
+
+// defaultPowerDNSTTL is used when no ttl is configured, PowerDNS requires one
+const defaultPowerDNSTTL = 300
+
+// NewPowerDNSProvider creates a new PowerDNS provider managing records in zone
+func NewPowerDNSProvider(hostname, apiKey, zone string, ttl int, timeout time.Duration, tlsConfig *tls.Config, logger *zap.Logger, debug bool) (*PowerDNSProvider, error) {
+	if hostname == "" || apiKey == "" || zone == "" {
+		return nil, errors.New("powerdns provider requires hostname, api_key, and zone")
+	}
+
+	// The API listens on plain HTTP (port 8081) by default, allow an explicit scheme in hostname
+	baseURL := hostname
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	if ttl <= 0 {
+		ttl = defaultPowerDNSTTL
+	}
+
+	// A nil tlsConfig keeps the default verification
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+	}
+
+	zone = canonicalName(zone)
+
+	if debug {
+		logger.Debug("PowerDNS provider created",
+			zap.String("base_url", baseURL),
+			zap.String("zone", zone),
+			zap.Int("ttl", ttl),
+			zap.Duration("timeout", timeout),
+			zap.Bool("custom_tls", tlsConfig != nil))
+	}
+
+	return &PowerDNSProvider{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		zone:    zone,
+		ttl:     ttl,
+		client:  client,
+		logger:  logger,
+		debug:   debug,
+	}, nil
+}
+
+func (p *PowerDNSProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := p.checkDomain(domain); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("creating PowerDNS record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	// PATCH replaces whole RRsets, keep the records already present
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	values := []string{value}
+	for _, record := range filterRecords(records, recordType) {
+		values = append(values, record.Value)
+	}
+
+	if err := p.replaceRRset(ctx, domain, recordType, values, true); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("PowerDNS record created successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *PowerDNSProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := p.checkDomain(domain); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("updating PowerDNS record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	// Replacing the RRset updates in place and drops any duplicates
+	if err := p.replaceRRset(ctx, domain, recordType, []string{value}, true); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("PowerDNS record updated successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *PowerDNSProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if err := p.checkDomain(domain); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("deleting PowerDNS record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	// Deleting a missing RRset succeeds, no lookup needed
+	rrset := powerDNSRRset{
+		Name:       canonicalName(domain),
+		Type:       recordType,
+		ChangeType: "DELETE",
+		Records:    []powerDNSRecord{},
+	}
+	if _, err := p.apiCall(ctx, "PATCH", map[string][]powerDNSRRset{"rrsets": {rrset}}); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("PowerDNS record deleted successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *PowerDNSProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if err := p.checkDomain(domain); err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("searching PowerDNS records", zap.String("domain", domain))
+	}
+
+	resp, err := p.apiCall(ctx, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var zone struct {
+		RRsets []powerDNSRRset `json:"rrsets"`
+	}
+	if err := json.Unmarshal(resp, &zone); err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("found PowerDNS RRsets", zap.Int("count", len(zone.RRsets)))
+	}
+
+	name := canonicalName(domain)
+	var records []*DNSRecord
+	for _, rrset := range zone.RRsets {
+		if !strings.EqualFold(rrset.Name, name) {
+			continue
+		}
+		switch rrset.Type {
+		case "A", "AAAA", "CNAME", "TXT", "SRV", "PTR":
+		default:
+			continue
+		}
+
+		var description string
+		if len(rrset.Comments) > 0 {
+			description = rrset.Comments[0].Content
+		}
+		for _, record := range rrset.Records {
+			value := record.Content
+			if rrset.Type == "TXT" {
+				value = unquoteTXT(value)
+			}
+
+			if p.debug {
+				p.logger.Debug("found matching PowerDNS record",
+					zap.String("domain", domain),
+					zap.String("record_type", rrset.Type),
+					zap.String("value", value),
+					zap.Bool("disabled", record.Disabled))
+			}
+			records = append(records, &DNSRecord{
+				Domain:      domain,
+				Value:       value,
+				RecordType:  rrset.Type,
+				Enabled:     !record.Disabled,
+				Description: description,
+			})
+		}
+	}
+
+	if p.debug && len(records) == 0 {
+		p.logger.Debug("no matching PowerDNS record found", zap.String("domain", domain))
+	}
+	return records, nil
+}
+
+// ListRecords returns the records of the zone commented by this plugin
+func (p *PowerDNSProvider) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	if p.debug {
+		p.logger.Debug("listing managed PowerDNS records", zap.String("zone", p.zone))
+	}
+
+	resp, err := p.apiCall(ctx, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var zone struct {
+		RRsets []powerDNSRRset `json:"rrsets"`
+	}
+	if err := json.Unmarshal(resp, &zone); err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, rrset := range zone.RRsets {
+		if len(rrset.Comments) == 0 || !isManaged(rrset.Comments[0].Content, managedDescription) {
+			continue
+		}
+		for _, record := range rrset.Records {
+			value := record.Content
+			if rrset.Type == "TXT" {
+				value = unquoteTXT(value)
+			}
+			records = append(records, &DNSRecord{
+				Domain:      strings.TrimSuffix(rrset.Name, "."),
+				Value:       value,
+				RecordType:  rrset.Type,
+				Enabled:     !record.Disabled,
+				Description: rrset.Comments[0].Content,
+			})
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("found managed PowerDNS records", zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *PowerDNSProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating PowerDNS connectivity", zap.String("base_url", p.baseURL), zap.String("zone", p.zone))
+	}
+
+	_, err := p.apiCall(ctx, "GET", nil)
+	return err
+}
+
+func (p *PowerDNSProvider) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	if err := p.checkDomain(domain); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("toggling PowerDNS record", zap.String("domain", domain), zap.String("record_type", recordType), zap.Bool("enabled", enabled))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(existing))
+	for _, record := range existing {
+		values = append(values, record.Value)
+	}
+	return p.replaceRRset(ctx, domain, recordType, values, enabled)
+}
+
+// replaceRRset sets the records of the given type to values
+func (p *PowerDNSProvider) replaceRRset(ctx context.Context, domain, recordType string, values []string, enabled bool) error {
+	rrset := powerDNSRRset{
+		Name:       canonicalName(domain),
+		Type:       recordType,
+		TTL:        p.ttl,
+		ChangeType: "REPLACE",
+		Comments:   []powerDNSComment{{Content: recordDescription(ctx, managedDescription), Account: "caddy-local-dns"}},
+	}
+	for _, value := range values {
+		// CNAME and PTR targets must be fully qualified, TXT content is quoted
+		switch recordType {
+		case "CNAME", "PTR":
+			value = canonicalName(value)
+		case "TXT":
+			value = quoteTXT(value)
+		}
+		rrset.Records = append(rrset.Records, powerDNSRecord{Content: value, Disabled: !enabled})
+	}
+
+	_, err := p.apiCall(ctx, "PATCH", map[string][]powerDNSRRset{"rrsets": {rrset}})
+	return err
+}
+
+// quoteTXT returns value as a quoted TXT character string
+func quoteTXT(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// unquoteTXT joins the quoted character strings of TXT content
+func unquoteTXT(content string) string {
+	var out strings.Builder
+	var quoted, escaped bool
+	for _, r := range content {
+		switch {
+		case escaped:
+			out.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// checkDomain makes sure domain belongs to the configured zone
+func (p *PowerDNSProvider) checkDomain(domain string) error {
+	if !inZone(domain, p.zone) {
+		return fmt.Errorf("domain %s is not part of zone %s", domain, p.zone)
+	}
+	return nil
+}
+
+// apiCall sends a request to the configured zone's endpoint
+func (p *PowerDNSProvider) apiCall(ctx context.Context, method string, payload any) ([]byte, error) {
+	apiURL := fmt.Sprintf("%s/api/v1/servers/localhost/zones/%s", p.baseURL, url.PathEscape(p.zone))
+
+	if p.debug {
+		p.logger.Debug("making API call",
+			zap.String("method", method),
+			zap.String("url", apiURL),
+			zap.Any("payload", payload))
+	}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", p.apiKey)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.debug {
+			p.logger.Debug("API call failed", zap.Error(err))
+		}
+		if strings.Contains(err.Error(), "certificate") || strings.Contains(err.Error(), "tls") {
+			return nil, fmt.Errorf("SSL/TLS error connecting to PowerDNS API. If using self-signed certificates, set 'ca_cert' or enable 'insecure' option: %w", err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("API call response",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(out)))
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, string(out))
+	}
+	return out, nil
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*PowerDNSProvider)(nil)
+	_ Toggler    = (*PowerDNSProvider)(nil)
+	_ Lister     = (*PowerDNSProvider)(nil)
+)
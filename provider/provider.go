@@ -0,0 +1,259 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSService interface for different DNS backends. Records are identified by
+// domain and type; value is an IP address for A/AAAA, a host name for CNAME
+// and PTR and formatted by SRVValue for SRV. CreateRecord adds a record next
+// to existing ones of the type, UpdateRecord replaces all of them.
+// Calls are aborted when ctx is done.
+type DNSService interface {
+	CreateRecord(ctx context.Context, domain, recordType, value string) error
+	DeleteRecord(ctx context.Context, domain, recordType string) error
+	UpdateRecord(ctx context.Context, domain, recordType, value string) error
+	FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error)
+	// Validate checks that the backend is reachable and accepts the credentials
+	Validate(ctx context.Context) error
+}
+
+// Batcher is implemented by providers that can apply several changes at
+// once, e.g. with a single service reload
+type Batcher interface {
+	// BeginBatch defers applying changes until EndBatch is called
+	BeginBatch()
+	// EndBatch applies the changes made since BeginBatch. Batches may
+	// overlap, changes are applied when the last one ends.
+	EndBatch() error
+	// Flush applies all deferred changes immediately
+	Flush() error
+}
+
+// Toggler is implemented by providers that can disable records without
+// deleting them
+type Toggler interface {
+	// SetEnabled enables or disables all records of domain with recordType
+	SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error
+}
+
+// ErrToggleUnsupported is returned by SetEnabled for providers that can't
+// disable records
+var ErrToggleUnsupported = errors.New("enabling or disabling records is not supported by this provider")
+
+// SetEnabled enables or disables records through s if it is a Toggler
+func SetEnabled(ctx context.Context, s DNSService, domain, recordType string, enabled bool) error {
+	toggler, ok := s.(Toggler)
+	if !ok {
+		return ErrToggleUnsupported
+	}
+	return toggler.SetEnabled(ctx, domain, recordType, enabled)
+}
+
+// Lister is implemented by providers that can find the records created by
+// this plugin, recognized by their description or comment
+type Lister interface {
+	// ListRecords returns all records created by this plugin
+	ListRecords(ctx context.Context) ([]*DNSRecord, error)
+}
+
+// ErrListUnsupported is returned by ListRecords for providers that can't
+// tell which records were created by this plugin
+var ErrListUnsupported = errors.New("listing managed records is not supported by this provider")
+
+// ListRecords returns the records created by this plugin through s if it is
+// a Lister
+func ListRecords(ctx context.Context, s DNSService) ([]*DNSRecord, error) {
+	lister, ok := s.(Lister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+	return lister.ListRecords(ctx)
+}
+
+// managedDescription marks records created by this plugin
+const managedDescription = "Generated by Caddy Local DNS"
+
+// tagKey is the context key of the tag set by WithTag
+type tagKey struct{}
+
+// WithTag returns a context in which CreateRecord and UpdateRecord append
+// tag to the description of the written record, e.g. the name of the site.
+// Providers without descriptions ignore it.
+func WithTag(ctx context.Context, tag string) context.Context {
+	// Descriptions end up in single lines, e.g. of hosts files
+	tag = strings.Join(strings.Fields(tag), " ")
+	return context.WithValue(ctx, tagKey{}, tag)
+}
+
+// recordDescription returns base with the tag of ctx, if any, appended
+func recordDescription(ctx context.Context, base string) string {
+	if tag, _ := ctx.Value(tagKey{}).(string); tag != "" {
+		return base + " [" + tag + "]"
+	}
+	return base
+}
+
+// isManaged reports whether description is base, tagged or not
+func isManaged(description, base string) bool {
+	if description == base {
+		return true
+	}
+	tag, ok := strings.CutPrefix(description, base+" [")
+	return ok && strings.HasSuffix(tag, "]")
+}
+
+// DNSRecord represents a DNS record
+type DNSRecord struct {
+	Domain      string
+	Value       string // IP address or CNAME target
+	RecordType  string
+	UUID        string // ID assigned by the provider, empty if it has none
+	Enabled     bool
+	Description string
+}
+
+// recordIDKey is the context key of the ID sink set by WithRecordID
+type recordIDKey struct{}
+
+// WithRecordID returns a context in which CreateRecord and UpdateRecord
+// store the ID the provider assigned to the written record in id. It is
+// left empty by providers without record IDs.
+func WithRecordID(ctx context.Context, id *string) context.Context {
+	return context.WithValue(ctx, recordIDKey{}, id)
+}
+
+// setRecordID reports the ID of a written record to the sink of ctx
+func setRecordID(ctx context.Context, id string) {
+	if sink, ok := ctx.Value(recordIDKey{}).(*string); ok {
+		*sink = id
+	}
+}
+
+// DefaultTimeout bounds provider requests when no timeout is configured
+const DefaultTimeout = 10 * time.Second
+
+// RecordTypeForIP returns "AAAA" for IPv6 addresses and "A" otherwise
+func RecordTypeForIP(ip string) string {
+	if parsedIP := net.ParseIP(ip); parsedIP != nil && parsedIP.To4() == nil {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// SRVValue formats the value of an SRV record as "priority weight port target"
+func SRVValue(priority, weight, port int, target string) string {
+	return fmt.Sprintf("%d %d %d %s", priority, weight, port, canonicalName(target))
+}
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name of ip, without
+// trailing dot, or "" if ip isn't an IP address
+func ReverseName(ip string) string {
+	name, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+// IsReverseName reports whether domain is within in-addr.arpa or ip6.arpa
+func IsReverseName(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return strings.HasSuffix(domain, ".in-addr.arpa") || strings.HasSuffix(domain, ".ip6.arpa")
+}
+
+// ErrUnsupportedRecordType reports a record type the backend can't manage
+type ErrUnsupportedRecordType struct {
+	RecordType string
+	Backend    string
+}
+
+func (e ErrUnsupportedRecordType) Error() string {
+	return fmt.Sprintf("%s records are not supported by %s", e.RecordType, e.Backend)
+}
+
+// Errors wrapped by providers so callers can tell failures apart with
+// errors.Is
+var (
+	// ErrNotFound reports a record or API object that doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized reports rejected credentials or missing permissions
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrConflict reports a change rejected by the backend, e.g. because it
+	// failed validation or clashes with an existing record
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable reports a backend that can't be reached or failed
+	// internally
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// statusError returns the error of an HTTP API response with status code
+// 400 or above, wrapping the matching error above
+func statusError(statusCode int, body []byte) error {
+	err := fmt.Errorf("api error %d: %s", statusCode, string(body))
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	case statusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case statusCode == http.StatusConflict:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case statusCode >= 500:
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	default:
+		return err
+	}
+}
+
+// Retryable reports whether a call failing with err may succeed when tried
+// again. Unknown errors are assumed to be temporary.
+func Retryable(err error) bool {
+	var unsupported ErrUnsupportedRecordType
+	switch {
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrConflict), errors.Is(err, ErrNotFound), errors.Is(err, ErrNotConfirmed):
+		return false
+	case errors.Is(err, context.Canceled), errors.As(err, &unsupported):
+		return false
+	default:
+		return true
+	}
+}
+
+// IsWildcard reports whether domain is a wildcard name such as *.example.com
+func IsWildcard(domain string) bool {
+	return strings.HasPrefix(domain, "*.")
+}
+
+// canonicalName returns name with a trailing dot
+func canonicalName(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// inZone reports whether domain is zone itself or one of its subdomains
+func inZone(domain, zone string) bool {
+	name := strings.ToLower(canonicalName(domain))
+	zone = strings.ToLower(canonicalName(zone))
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// filterRecords returns the records of the given type
+func filterRecords(records []*DNSRecord, recordType string) []*DNSRecord {
+	var out []*DNSRecord
+	for _, record := range records {
+		if record.RecordType == recordType {
+			out = append(out, record)
+		}
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitedService wraps a DNSService and spaces out its calls with a
+// token bucket. A random jitter keeps queued calls from firing in bursts.
+type RateLimitedService struct {
+	inner   DNSService
+	limiter *rate.Limiter
+	jitter  time.Duration
+}
+
+// NewRateLimitedService wraps inner so at most perSecond calls are made per
+// second. Each call is delayed by up to half the interval between calls.
+func NewRateLimitedService(inner DNSService, perSecond float64) *RateLimitedService {
+	return &RateLimitedService{
+		inner:   inner,
+		limiter: rate.NewLimiter(rate.Limit(perSecond), 1),
+		jitter:  time.Duration(float64(time.Second) / perSecond / 2),
+	}
+}
+
+func (r *RateLimitedService) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	return r.inner.CreateRecord(ctx, domain, recordType, value)
+}
+
+func (r *RateLimitedService) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	return r.inner.DeleteRecord(ctx, domain, recordType)
+}
+
+func (r *RateLimitedService) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	return r.inner.UpdateRecord(ctx, domain, recordType, value)
+}
+
+func (r *RateLimitedService) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	return SetEnabled(ctx, r.inner, domain, recordType, enabled)
+}
+
+func (r *RateLimitedService) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.inner.FindRecord(ctx, domain)
+}
+
+func (r *RateLimitedService) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	return ListRecords(ctx, r.inner)
+}
+
+func (r *RateLimitedService) Validate(ctx context.Context) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	return r.inner.Validate(ctx)
+}
+
+// wait blocks until the limiter allows a call and the jitter has passed
+func (r *RateLimitedService) wait(ctx context.Context) error {
+	if err := r.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	if r.jitter <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(rand.N(r.jitter))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*RateLimitedService)(nil)
+	_ Toggler    = (*RateLimitedService)(nil)
+	_ Lister     = (*RateLimitedService)(nil)
+)
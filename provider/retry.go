@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetryService wraps a DNSService and retries failed calls with exponential backoff
+type RetryService struct {
+	inner     DNSService
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	logger    *zap.Logger
+}
+
+// NewRetryService wraps inner so every call is attempted up to attempts times.
+// The delay starts at baseDelay and doubles after each failure, capped at
+// maxDelay. Waiting stops as soon as the context of the call is done.
+func NewRetryService(inner DNSService, attempts int, baseDelay, maxDelay time.Duration, logger *zap.Logger) *RetryService {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if maxDelay < baseDelay {
+		maxDelay = baseDelay
+	}
+	return &RetryService{
+		inner:     inner,
+		attempts:  attempts,
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+		logger:    logger,
+	}
+}
+
+func (r *RetryService) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	return r.do(ctx, "create record", domain, func() error {
+		return r.inner.CreateRecord(ctx, domain, recordType, value)
+	})
+}
+
+func (r *RetryService) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	return r.do(ctx, "delete record", domain, func() error {
+		return r.inner.DeleteRecord(ctx, domain, recordType)
+	})
+}
+
+func (r *RetryService) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	return r.do(ctx, "update record", domain, func() error {
+		return r.inner.UpdateRecord(ctx, domain, recordType, value)
+	})
+}
+
+func (r *RetryService) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	return r.do(ctx, "set enabled", domain, func() error {
+		return SetEnabled(ctx, r.inner, domain, recordType, enabled)
+	})
+}
+
+func (r *RetryService) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	var records []*DNSRecord
+	err := r.do(ctx, "find record", domain, func() error {
+		var err error
+		records, err = r.inner.FindRecord(ctx, domain)
+		return err
+	})
+	return records, err
+}
+
+func (r *RetryService) ListRecords(ctx context.Context) ([]*DNSRecord, error) {
+	var records []*DNSRecord
+	unsupported := false
+	err := r.do(ctx, "list records", "", func() error {
+		var err error
+		records, err = ListRecords(ctx, r.inner)
+		if errors.Is(err, ErrListUnsupported) {
+			// Retrying won't help
+			unsupported = true
+			return nil
+		}
+		return err
+	})
+	if unsupported {
+		return nil, ErrListUnsupported
+	}
+	return records, err
+}
+
+func (r *RetryService) Validate(ctx context.Context) error {
+	return r.inner.Validate(ctx)
+}
+
+func (r *RetryService) do(ctx context.Context, op, domain string, fn func() error) error {
+	delay := r.baseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if !Retryable(err) {
+			return err
+		}
+		if attempt >= r.attempts {
+			if r.attempts > 1 {
+				return fmt.Errorf("%s failed after %d attempts: %w", op, attempt, err)
+			}
+			return err
+		}
+
+		r.logger.Warn("provider call failed, retrying",
+			zap.String("operation", op),
+			zap.String("domain", domain),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s aborted after %d attempts: %w", op, attempt, err)
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if delay > r.maxDelay {
+			delay = r.maxDelay
+		}
+	}
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*RetryService)(nil)
+	_ Toggler    = (*RetryService)(nil)
+	_ Lister     = (*RetryService)(nil)
+)
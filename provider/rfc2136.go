@@ -0,0 +1,359 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// RFC2136Provider implements DNSService with DNS UPDATE messages (RFC 2136),
+// optionally authenticated with TSIG. It works with BIND, Knot and others.
+type RFC2136Provider struct {
+	server  string
+	zone    string // canonical, with trailing dot
+	ttl     int
+	keyName string // canonical, empty without TSIG
+	keyAlg  string
+	client  *dns.Client
+	logger  *zap.Logger
+	debug   bool
+}
+
+// defaultRFC2136TTL is used when no ttl is configured
+const defaultRFC2136TTL = 300
+
+// NewRFC2136Provider creates a new RFC 2136 provider. server is the address
+// of the primary name server (port 53 unless given). keyName, keySecret
+// (base64) and keyAlgorithm configure TSIG, the algorithm defaults to
+// hmac-sha256. TSIG is disabled when keyName is empty.
+func NewRFC2136Provider(server, zone, keyName, keySecret, keyAlgorithm string, ttl int, timeout time.Duration, logger *zap.Logger, debug bool) (*RFC2136Provider, error) {
+	if server == "" || zone == "" {
+		return nil, errors.New("rfc2136 provider requires hostname and zone")
+	}
+	if (keyName == "") != (keySecret == "") {
+		return nil, errors.New("rfc2136 provider requires both tsig_key and tsig_secret")
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	if ttl <= 0 {
+		ttl = defaultRFC2136TTL
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	// TCP avoids truncated responses and is what most servers expect for updates
+	client := &dns.Client{
+		Net:     "tcp",
+		Timeout: timeout,
+	}
+
+	var keyAlg string
+	if keyName != "" {
+		keyName = dns.Fqdn(strings.ToLower(keyName))
+		keyAlg = dns.HmacSHA256
+		if keyAlgorithm != "" {
+			keyAlg = dns.Fqdn(strings.ToLower(keyAlgorithm))
+		}
+		client.TsigSecret = map[string]string{keyName: keySecret}
+	}
+
+	if debug {
+		logger.Debug("RFC 2136 provider created",
+			zap.String("server", server),
+			zap.String("zone", dns.Fqdn(zone)),
+			zap.String("tsig_key", keyName),
+			zap.String("tsig_algorithm", keyAlg),
+			zap.Int("ttl", ttl),
+			zap.Duration("timeout", timeout))
+	}
+
+	return &RFC2136Provider{
+		server:  server,
+		zone:    dns.Fqdn(zone),
+		ttl:     ttl,
+		keyName: keyName,
+		keyAlg:  keyAlg,
+		client:  client,
+		logger:  logger,
+		debug:   debug,
+	}, nil
+}
+
+func (p *RFC2136Provider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("creating RFC 2136 record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	rr, err := p.newRR(domain, recordType, value)
+	if err != nil {
+		return err
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(p.zone)
+	m.Insert([]dns.RR{rr})
+	if err := p.update(ctx, m); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("RFC 2136 record created successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *RFC2136Provider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("updating RFC 2136 record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	rr, err := p.newRR(domain, recordType, value)
+	if err != nil {
+		return err
+	}
+
+	// Both operations are applied atomically within one message
+	m := new(dns.Msg)
+	m.SetUpdate(p.zone)
+	m.RemoveRRset([]dns.RR{p.rrsetHeader(domain, recordType)})
+	m.Insert([]dns.RR{rr})
+	if err := p.update(ctx, m); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("RFC 2136 record updated successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *RFC2136Provider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if !inZone(domain, p.zone) {
+		return fmt.Errorf("domain %s is not part of zone %s", domain, p.zone)
+	}
+
+	if p.debug {
+		p.logger.Debug("deleting RFC 2136 record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	// Removing a missing RRset succeeds, no lookup needed
+	m := new(dns.Msg)
+	m.SetUpdate(p.zone)
+	m.RemoveRRset([]dns.RR{p.rrsetHeader(domain, recordType)})
+	if err := p.update(ctx, m); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("RFC 2136 record deleted successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *RFC2136Provider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if !inZone(domain, p.zone) {
+		return nil, fmt.Errorf("domain %s is not part of zone %s", domain, p.zone)
+	}
+
+	if p.debug {
+		p.logger.Debug("searching RFC 2136 records", zap.String("domain", domain))
+	}
+
+	// ANY queries are unreliable, ask for each managed type. A CNAME is
+	// returned for any of them. SRV records only exist on service names.
+	name := dns.Fqdn(domain)
+	qtypes := []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeTXT}
+	if strings.HasPrefix(domain, "_") {
+		qtypes = append(qtypes, dns.TypeSRV)
+	}
+	if IsReverseName(domain) {
+		qtypes = append(qtypes, dns.TypePTR)
+	}
+	seen := make(map[string]bool)
+	var records []*DNSRecord
+	for _, qtype := range qtypes {
+		answer, err := p.query(ctx, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rr := range answer {
+			if !strings.EqualFold(rr.Header().Name, name) {
+				continue
+			}
+
+			var value string
+			switch rr := rr.(type) {
+			case *dns.A:
+				value = rr.A.String()
+			case *dns.AAAA:
+				value = rr.AAAA.String()
+			case *dns.CNAME:
+				value = rr.Target
+			case *dns.PTR:
+				value = rr.Ptr
+			case *dns.TXT:
+				value = strings.Join(rr.Txt, "")
+			case *dns.SRV:
+				value = SRVValue(int(rr.Priority), int(rr.Weight), int(rr.Port), rr.Target)
+			default:
+				continue
+			}
+
+			recordType := dns.TypeToString[rr.Header().Rrtype]
+			if seen[recordType+" "+value] {
+				continue
+			}
+			seen[recordType+" "+value] = true
+
+			if p.debug {
+				p.logger.Debug("found matching RFC 2136 record",
+					zap.String("domain", domain),
+					zap.String("record_type", recordType),
+					zap.String("value", value))
+			}
+			records = append(records, &DNSRecord{
+				Domain:     domain,
+				Value:      value,
+				RecordType: recordType,
+				Enabled:    true,
+			})
+		}
+	}
+
+	if p.debug && len(records) == 0 {
+		p.logger.Debug("no matching RFC 2136 record found", zap.String("domain", domain))
+	}
+	return records, nil
+}
+
+func (p *RFC2136Provider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating RFC 2136 server", zap.String("server", p.server), zap.String("zone", p.zone))
+	}
+
+	// The server must be authoritative for the zone
+	answer, err := p.query(ctx, p.zone, dns.TypeSOA)
+	if err != nil {
+		return err
+	}
+	for _, rr := range answer {
+		if _, ok := rr.(*dns.SOA); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("server %s returned no SOA for zone %s", p.server, p.zone)
+}
+
+// newRR builds the record to insert, CNAME targets are made fully qualified
+func (p *RFC2136Provider) newRR(domain, recordType, value string) (dns.RR, error) {
+	if !inZone(domain, p.zone) {
+		return nil, fmt.Errorf("domain %s is not part of zone %s", domain, p.zone)
+	}
+
+	switch recordType {
+	case "A", "AAAA", "SRV":
+	case "CNAME", "PTR":
+		value = dns.Fqdn(value)
+	case "TXT":
+		// Built directly, the value may contain spaces and quotes
+		return &dns.TXT{
+			Hdr: dns.RR_Header{Name: dns.Fqdn(domain), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: uint32(p.ttl)},
+			Txt: splitTXT(value),
+		}, nil
+	default:
+		return nil, ErrUnsupportedRecordType{RecordType: recordType, Backend: "the RFC 2136 provider"}
+	}
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(domain), p.ttl, recordType, value))
+}
+
+// splitTXT splits value into character strings of at most 255 bytes
+func splitTXT(value string) []string {
+	var parts []string
+	for len(value) > 255 {
+		parts = append(parts, value[:255])
+		value = value[255:]
+	}
+	return append(parts, value)
+}
+
+// rrsetHeader returns an empty record identifying the RRset of domain and recordType
+func (p *RFC2136Provider) rrsetHeader(domain, recordType string) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{
+		Name:   dns.Fqdn(domain),
+		Rrtype: dns.StringToType[recordType],
+		Class:  dns.ClassINET,
+	}}
+}
+
+// query asks the server for name and qtype and returns the answer section
+func (p *RFC2136Provider) query(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = false
+
+	r, err := p.exchange(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("query for %s %s failed: %s", name, dns.TypeToString[qtype], dns.RcodeToString[r.Rcode])
+	}
+	return r.Answer, nil
+}
+
+// update sends an UPDATE message and checks the response code
+func (p *RFC2136Provider) update(ctx context.Context, m *dns.Msg) error {
+	r, err := p.exchange(ctx, m)
+	if err != nil {
+		return err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("update of zone %s failed: %s", p.zone, dns.RcodeToString[r.Rcode])
+	}
+	return nil
+}
+
+// exchange signs m if TSIG is configured and sends it to the server
+func (p *RFC2136Provider) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	if p.keyName != "" {
+		m.SetTsig(p.keyName, p.keyAlg, 300, time.Now().Unix())
+	}
+
+	if p.debug {
+		p.logger.Debug("sending DNS message",
+			zap.String("server", p.server),
+			zap.String("message", m.String()))
+	}
+
+	r, _, err := p.client.ExchangeContext(ctx, m, p.server)
+	if err != nil {
+		if p.debug {
+			p.logger.Debug("DNS exchange failed", zap.Error(err))
+		}
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("DNS response",
+			zap.String("rcode", dns.RcodeToString[r.Rcode]),
+			zap.Int("answers", len(r.Answer)))
+	}
+	return r, nil
+}
+
+// Interface compliance
+var _ DNSService = (*RFC2136Provider)(nil)
@@ -0,0 +1,409 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TechnitiumProvider implements DNSService for Technitium DNS Server
+type TechnitiumProvider struct {
+	baseURL string
+	token   string
+	ttl     int
+	client  *http.Client
+	logger  *zap.Logger
+	debug   bool
+}
+
+// technitiumRecord represents a record as returned by /api/zones/records/get
+type technitiumRecord struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	TTL      int    `json:"ttl"`
+	Disabled bool   `json:"disabled"`
+	Comments string `json:"comments"`
+	RData    struct {
+		IPAddress string `json:"ipAddress"`
+		CNAME     string `json:"cname"`
+		PTRName   string `json:"ptrName"`
+		Text      string `json:"text"`
+	} `json:"rData"`
+}
+
+// NewTechnitiumProvider creates a new Technitium DNS Server provider
+func NewTechnitiumProvider(hostname, token string, ttl int, timeout time.Duration, tlsConfig *tls.Config, logger *zap.Logger, debug bool) (*TechnitiumProvider, error) {
+	if hostname == "" || token == "" {
+		return nil, errors.New("technitium provider requires hostname and api_key")
+	}
+
+	// Technitium serves plain HTTP on port 5380 by default, allow an explicit scheme in hostname
+	baseURL := hostname
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	// A nil tlsConfig keeps the default verification
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+	}
+
+	if debug {
+		logger.Debug("Technitium provider created",
+			zap.String("base_url", baseURL),
+			zap.Int("ttl", ttl),
+			zap.Duration("timeout", timeout),
+			zap.Bool("custom_tls", tlsConfig != nil))
+	}
+
+	return &TechnitiumProvider{
+		baseURL: baseURL,
+		token:   token,
+		ttl:     ttl,
+		client:  client,
+		logger:  logger,
+		debug:   debug,
+	}, nil
+}
+
+func (p *TechnitiumProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if !strings.Contains(domain, ".") {
+		return fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+
+	param, err := technitiumValueParam(recordType)
+	if err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("creating Technitium record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	params := url.Values{
+		"domain":   {domain},
+		"type":     {recordType},
+		param:      {value},
+		"comments": {recordDescription(ctx, managedDescription)},
+	}
+	// Leave ttl unset to keep the zone default
+	if p.ttl > 0 {
+		params.Set("ttl", strconv.Itoa(p.ttl))
+	}
+
+	if _, err := p.apiCall(ctx, "zones/records/add", params); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("Technitium record created successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *TechnitiumProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("updating Technitium record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	if _, err := technitiumValueParam(recordType); err != nil {
+		return err
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		p.logger.Info("record not found during update, creating new one", zap.String("domain", domain))
+		return p.CreateRecord(ctx, domain, recordType, value)
+	}
+
+	// Update the first record in place and drop any duplicates
+	if err := p.updateRecord(ctx, domain, recordType, existing[0].Value, value, true); err != nil {
+		return err
+	}
+
+	for _, record := range existing[1:] {
+		if err := p.deleteRecord(ctx, domain, recordType, record.Value); err != nil {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("Technitium record updated successfully", zap.String("domain", domain))
+	}
+	return nil
+}
+
+func (p *TechnitiumProvider) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	if p.debug {
+		p.logger.Debug("toggling Technitium record", zap.String("domain", domain), zap.String("record_type", recordType), zap.Bool("enabled", enabled))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	for _, record := range filterRecords(records, recordType) {
+		if record.Enabled == enabled {
+			continue
+		}
+		if err := p.updateRecord(ctx, domain, recordType, record.Value, record.Value, enabled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateRecord changes the record holding oldValue. Address and TXT records
+// are identified by their current value, a name has one CNAME.
+func (p *TechnitiumProvider) updateRecord(ctx context.Context, domain, recordType, oldValue, value string, enabled bool) error {
+	param, err := technitiumValueParam(recordType)
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{
+		"domain":  {domain},
+		"type":    {recordType},
+		"disable": {strconv.FormatBool(!enabled)},
+	}
+	switch recordType {
+	case "CNAME":
+		params.Set(param, value)
+	case "TXT":
+		params.Set(param, oldValue)
+		params.Set("newText", value)
+	case "PTR":
+		params.Set(param, oldValue)
+		params.Set("newPtrName", value)
+	default:
+		params.Set(param, oldValue)
+		params.Set("newIpAddress", value)
+	}
+	if p.ttl > 0 {
+		params.Set("ttl", strconv.Itoa(p.ttl))
+	}
+	_, err = p.apiCall(ctx, "zones/records/update", params)
+	return err
+}
+
+func (p *TechnitiumProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting Technitium record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		if p.debug {
+			p.logger.Debug("record not found, nothing to delete", zap.String("domain", domain))
+		}
+		return nil // Already deleted
+	}
+
+	for _, record := range existing {
+		if err := p.deleteRecord(ctx, domain, recordType, record.Value); err != nil {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("Technitium record deleted successfully", zap.String("domain", domain), zap.Int("count", len(existing)))
+	}
+	return nil
+}
+
+func (p *TechnitiumProvider) deleteRecord(ctx context.Context, domain, recordType, value string) error {
+	param, err := technitiumValueParam(recordType)
+	if err != nil {
+		return err
+	}
+	_, err = p.apiCall(ctx, "zones/records/delete", url.Values{
+		"domain": {domain},
+		"type":   {recordType},
+		param:    {value},
+	})
+	return err
+}
+
+// technitiumValueParam returns the API parameter holding the record value
+func technitiumValueParam(recordType string) (string, error) {
+	switch recordType {
+	case "A", "AAAA":
+		return "ipAddress", nil
+	case "CNAME":
+		return "cname", nil
+	case "TXT":
+		return "text", nil
+	case "PTR":
+		return "ptrName", nil
+	default:
+		return "", ErrUnsupportedRecordType{RecordType: recordType, Backend: "the Technitium provider"}
+	}
+}
+
+func (p *TechnitiumProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if !strings.Contains(domain, ".") {
+		return nil, fmt.Errorf("domain must contain a dot: %s", domain)
+	}
+
+	if p.debug {
+		p.logger.Debug("searching Technitium records", zap.String("domain", domain))
+	}
+
+	resp, err := p.apiCall(ctx, "zones/records/get", url.Values{"domain": {domain}})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Records []technitiumRecord `json:"records"`
+	}
+	if err := json.Unmarshal(resp, &data); err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("found Technitium records", zap.Int("count", len(data.Records)))
+	}
+
+	var records []*DNSRecord
+	for _, row := range data.Records {
+		if !strings.EqualFold(row.Name, domain) {
+			continue
+		}
+
+		var value string
+		switch row.Type {
+		case "A", "AAAA":
+			value = row.RData.IPAddress
+		case "CNAME":
+			value = row.RData.CNAME
+		case "TXT":
+			value = row.RData.Text
+		case "PTR":
+			value = row.RData.PTRName
+		default:
+			continue
+		}
+
+		if p.debug {
+			p.logger.Debug("found matching Technitium record",
+				zap.String("domain", domain),
+				zap.String("record_type", row.Type),
+				zap.String("value", value),
+				zap.Bool("disabled", row.Disabled))
+		}
+		records = append(records, &DNSRecord{
+			Domain:      domain,
+			Value:       value,
+			RecordType:  row.Type,
+			Enabled:     !row.Disabled,
+			Description: row.Comments,
+		})
+	}
+
+	if p.debug && len(records) == 0 {
+		p.logger.Debug("no matching Technitium record found", zap.String("domain", domain))
+	}
+	return records, nil
+}
+
+func (p *TechnitiumProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating Technitium connectivity", zap.String("base_url", p.baseURL))
+	}
+
+	_, err := p.apiCall(ctx, "zones/list", url.Values{})
+	return err
+}
+
+// apiCall performs a request against the Technitium HTTP API and returns the
+// "response" object of a successful reply
+func (p *TechnitiumProvider) apiCall(ctx context.Context, endpoint string, params url.Values) ([]byte, error) {
+	apiURL := fmt.Sprintf("%s/api/%s", p.baseURL, endpoint)
+
+	if p.debug {
+		p.logger.Debug("making API call",
+			zap.String("url", apiURL),
+			zap.String("endpoint", endpoint))
+	}
+
+	params.Set("token", p.token)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.debug {
+			p.logger.Debug("API call failed", zap.Error(err))
+		}
+		if strings.Contains(err.Error(), "certificate") || strings.Contains(err.Error(), "tls") {
+			return nil, fmt.Errorf("SSL/TLS error connecting to Technitium API. If using self-signed certificates, set 'ca_cert' or enable 'insecure' option: %w", err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("API call response",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(out)))
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("api error %d: %s", resp.StatusCode, string(out))
+	}
+
+	// Technitium always answers 200 and reports failures in the body
+	var res struct {
+		Status       string          `json:"status"`
+		ErrorMessage string          `json:"errorMessage"`
+		Response     json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, err
+	}
+	if res.Status != "ok" {
+		return nil, fmt.Errorf("%s failed (%s): %s", endpoint, res.Status, res.ErrorMessage)
+	}
+	return res.Response, nil
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*TechnitiumProvider)(nil)
+	_ Toggler    = (*TechnitiumProvider)(nil)
+)
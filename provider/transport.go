@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// Connection pool defaults, sized so a burst of changes to one DNS server
+// reuses its connections instead of opening new ones
+const (
+	DefaultMaxIdleConns    = 16
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+// ConnPool tunes the connections a provider keeps to its API. Zero values
+// use the defaults.
+type ConnPool struct {
+	MaxIdleConns      int           // idle connections kept to the host
+	IdleConnTimeout   time.Duration // until an idle connection is closed
+	DisableKeepAlives bool          // a new connection per request
+}
+
+// newTransport returns a transport with Go's default dialer and proxy
+// settings, tlsConfig (nil for the default verification) and the pool
+// settings
+func newTransport(tlsConfig *tls.Config, pool ConnPool) *http.Transport {
+	maxIdle := pool.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = DefaultMaxIdleConns
+	}
+	idleTimeout := pool.IdleConnTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleConnTimeout
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsConfig
+	// Providers talk to a single host, so the pool is per host
+	tr.MaxIdleConns = maxIdle
+	tr.MaxIdleConnsPerHost = maxIdle
+	tr.IdleConnTimeout = idleTimeout
+	tr.DisableKeepAlives = pool.DisableKeepAlives
+	return tr
+}
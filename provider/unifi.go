@@ -0,0 +1,451 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// UnifiProvider implements DNSService for the static DNS records of a UniFi
+// Network application on UniFi OS (UDM, UCG, Cloud Key). It either sends an
+// API key or logs in with a local user, keeping the session cookie and
+// CSRF token until the controller rejects them.
+type UnifiProvider struct {
+	baseURL  string
+	site     string
+	username string
+	password string
+	apiKey   string // used instead of a login when set
+	ttl      int
+	client   *http.Client
+	logger   *zap.Logger
+	debug    bool
+
+	// session state of the login, the cookie itself lives in the jar
+	mu       sync.Mutex
+	loggedIn bool
+	csrf     string
+}
+
+// unifiRecord is an entry of the static-dns API
+type unifiRecord struct {
+	ID         string `json:"_id,omitempty"`
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	RecordType string `json:"record_type"`
+	Enabled    bool   `json:"enabled"`
+	TTL        int    `json:"ttl,omitempty"`
+}
+
+// NewUnifiProvider creates a new UniFi provider for the controller at
+// hostname, HTTPS is used unless another scheme is given. With a username
+// and password the provider logs in, a username alone is sent as API key.
+// site defaults to "default".
+func NewUnifiProvider(hostname, username, password, site string, ttl int, timeout time.Duration, tlsConfig *tls.Config, logger *zap.Logger, debug bool) (*UnifiProvider, error) {
+	if hostname == "" || username == "" {
+		return nil, errors.New("unifi provider requires hostname and api_key (API key or username)")
+	}
+
+	baseURL := hostname
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	if site == "" {
+		site = "default"
+	}
+
+	// Keeps the session cookie set by the login
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// A nil tlsConfig keeps the default verification
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+		Jar:       jar,
+	}
+
+	p := &UnifiProvider{
+		baseURL: baseURL,
+		site:    site,
+		ttl:     ttl,
+		client:  client,
+		logger:  logger,
+		debug:   debug,
+	}
+	if password == "" {
+		p.apiKey = username
+	} else {
+		p.username = username
+		p.password = password
+	}
+
+	if debug {
+		logger.Debug("UniFi provider created",
+			zap.String("base_url", baseURL),
+			zap.String("site", site),
+			zap.Bool("api_key", p.apiKey != ""),
+			zap.Int("ttl", ttl),
+			zap.Duration("timeout", timeout),
+			zap.Bool("custom_tls", tlsConfig != nil))
+	}
+	return p, nil
+}
+
+func (p *UnifiProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if err := checkUnifiType(recordType); err != nil {
+		return err
+	}
+
+	if p.debug {
+		p.logger.Debug("creating UniFi static DNS record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	resp, err := p.apiCall(ctx, "POST", "", p.newRecord(domain, recordType, value, true))
+	if err != nil {
+		return err
+	}
+	var created unifiRecord
+	if err := json.Unmarshal(resp, &created); err == nil {
+		setRecordID(ctx, created.ID)
+	}
+
+	if p.debug {
+		p.logger.Debug("UniFi static DNS record created successfully", zap.String("domain", domain), zap.String("id", created.ID))
+	}
+	return nil
+}
+
+func (p *UnifiProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("updating UniFi static DNS record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	if err := checkUnifiType(recordType); err != nil {
+		return err
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		p.logger.Info("record not found during update, creating new one", zap.String("domain", domain))
+		return p.CreateRecord(ctx, domain, recordType, value)
+	}
+
+	// Overwrite the first record and drop any duplicates
+	record := p.newRecord(domain, recordType, value, existing[0].Enabled)
+	record.ID = existing[0].UUID
+	if _, err := p.apiCall(ctx, "PUT", existing[0].UUID, record); err != nil {
+		return err
+	}
+	for _, record := range existing[1:] {
+		if _, err := p.apiCall(ctx, "DELETE", record.UUID, nil); err != nil {
+			return err
+		}
+	}
+	setRecordID(ctx, existing[0].UUID)
+
+	if p.debug {
+		p.logger.Debug("UniFi static DNS record updated successfully", zap.String("domain", domain), zap.String("id", existing[0].UUID))
+	}
+	return nil
+}
+
+func (p *UnifiProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting UniFi static DNS record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+	existing := filterRecords(records, recordType)
+	if len(existing) == 0 {
+		if p.debug {
+			p.logger.Debug("record not found, nothing to delete", zap.String("domain", domain))
+		}
+		return nil // Already deleted
+	}
+
+	for _, record := range existing {
+		if _, err := p.apiCall(ctx, "DELETE", record.UUID, nil); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("UniFi static DNS record deleted successfully", zap.String("domain", domain), zap.Int("count", len(existing)))
+	}
+	return nil
+}
+
+func (p *UnifiProvider) SetEnabled(ctx context.Context, domain, recordType string, enabled bool) error {
+	records, err := p.FindRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range filterRecords(records, recordType) {
+		if record.Enabled == enabled {
+			continue
+		}
+		updated := p.newRecord(domain, recordType, record.Value, enabled)
+		updated.ID = record.UUID
+		if _, err := p.apiCall(ctx, "PUT", record.UUID, updated); err != nil {
+			return err
+		}
+	}
+
+	if p.debug {
+		p.logger.Debug("UniFi static DNS record state changed", zap.String("domain", domain), zap.Bool("enabled", enabled))
+	}
+	return nil
+}
+
+func (p *UnifiProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if p.debug {
+		p.logger.Debug("searching UniFi static DNS records", zap.String("domain", domain))
+	}
+
+	rows, err := p.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, row := range rows {
+		if !strings.EqualFold(row.Key, domain) || checkUnifiType(row.RecordType) != nil {
+			continue
+		}
+		records = append(records, &DNSRecord{
+			Domain:     domain,
+			Value:      row.Value,
+			RecordType: row.RecordType,
+			UUID:       row.ID,
+			Enabled:    row.Enabled,
+		})
+	}
+
+	if p.debug {
+		p.logger.Debug("found UniFi static DNS records", zap.String("domain", domain), zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *UnifiProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating UniFi connectivity", zap.String("base_url", p.baseURL), zap.String("site", p.site))
+	}
+
+	// Logs in if needed and checks access to the site
+	_, err := p.records(ctx)
+	return err
+}
+
+// records returns all static DNS records of the site
+func (p *UnifiProvider) records(ctx context.Context) ([]unifiRecord, error) {
+	resp, err := p.apiCall(ctx, "GET", "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []unifiRecord
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// newRecord returns the payload creating or replacing a record
+func (p *UnifiProvider) newRecord(domain, recordType, value string, enabled bool) unifiRecord {
+	return unifiRecord{
+		Key:        domain,
+		Value:      value,
+		RecordType: recordType,
+		Enabled:    enabled,
+		TTL:        p.ttl,
+	}
+}
+
+// checkUnifiType rejects record types the provider doesn't manage
+func checkUnifiType(recordType string) error {
+	switch recordType {
+	case "A", "AAAA", "CNAME", "TXT":
+		return nil
+	default:
+		return ErrUnsupportedRecordType{RecordType: recordType, Backend: "the UniFi provider"}
+	}
+}
+
+// login starts a session with the username and password. The controller
+// sets the session cookie and returns the CSRF token required for changes.
+func (p *UnifiProvider) login(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("logging in to UniFi controller", zap.String("base_url", p.baseURL), zap.String("username", p.username))
+	}
+
+	data, err := json.Marshal(map[string]any{"username": p.username, "password": p.password, "remember": true})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/auth/login", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return p.connectionError(err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("login failed: %w", statusError(resp.StatusCode, out))
+	}
+	p.csrf = resp.Header.Get("X-CSRF-Token")
+	p.loggedIn = true
+	return nil
+}
+
+// apiCall sends a request to the static-dns API of the site, id is appended
+// to it. Sessions are started on demand and renewed once when rejected.
+func (p *UnifiProvider) apiCall(ctx context.Context, method, id string, payload any) ([]byte, error) {
+	out, status, err := p.send(ctx, method, id, payload)
+	if err == nil && status == http.StatusUnauthorized && p.apiKey == "" {
+		// The session expired, log in again
+		p.mu.Lock()
+		p.loggedIn = false
+		p.mu.Unlock()
+		out, status, err = p.send(ctx, method, id, payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status >= 400 {
+		return nil, statusError(status, out)
+	}
+	return out, nil
+}
+
+// send makes a single request and returns the response body and status
+func (p *UnifiProvider) send(ctx context.Context, method, id string, payload any) ([]byte, int, error) {
+	apiURL := fmt.Sprintf("%s/proxy/network/v2/api/site/%s/static-dns", p.baseURL, url.PathEscape(p.site))
+	if id != "" {
+		apiURL += "/" + url.PathEscape(id)
+	}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if p.apiKey != "" {
+		req.Header.Set("X-API-KEY", p.apiKey)
+	} else {
+		p.mu.Lock()
+		if !p.loggedIn {
+			if err := p.login(ctx); err != nil {
+				p.mu.Unlock()
+				return nil, 0, err
+			}
+		}
+		if p.csrf != "" {
+			req.Header.Set("X-CSRF-Token", p.csrf)
+		}
+		p.mu.Unlock()
+	}
+
+	if p.debug {
+		p.logger.Debug("making API call",
+			zap.String("method", method),
+			zap.String("url", apiURL),
+			zap.Any("payload", payload))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, 0, p.connectionError(err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if p.debug {
+		p.logger.Debug("API call response",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(out)))
+	}
+
+	// The token is rotated with the session
+	if token := resp.Header.Get("X-Updated-CSRF-Token"); token != "" {
+		p.mu.Lock()
+		p.csrf = token
+		p.mu.Unlock()
+	}
+	return out, resp.StatusCode, nil
+}
+
+// connectionError explains certificate errors of the controller's
+// self-signed certificate
+func (p *UnifiProvider) connectionError(err error) error {
+	if p.debug {
+		p.logger.Debug("API call failed", zap.Error(err))
+	}
+	if strings.Contains(err.Error(), "certificate") || strings.Contains(err.Error(), "tls") {
+		return fmt.Errorf("SSL/TLS error connecting to the UniFi controller. If using self-signed certificates, set 'ca_cert' or enable 'insecure' option: %w", err)
+	}
+	return err
+}
+
+// Interface compliance
+var (
+	_ DNSService = (*UnifiProvider)(nil)
+	_ Toggler    = (*UnifiProvider)(nil)
+)
@@ -0,0 +1,300 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WebhookProvider implements DNSService by calling an HTTP service, so any
+// backend can be connected without a dedicated provider.
+//
+// Changes are POSTed to the URL as a webhookRequest and succeed with any 2xx
+// status. The response may contain {"id": "..."} for the written record.
+// Lookups GET the URL with ?domain=<domain> and expect a JSON array of
+// webhookRecord, 404 meaning no records. 501 Not Implemented reports a
+// record type the backend doesn't support.
+type WebhookProvider struct {
+	url    string
+	token  string
+	ttl    int
+	client *http.Client
+	logger *zap.Logger
+	debug  bool
+}
+
+// webhookRequest is the body of a change
+type webhookRequest struct {
+	Action      string `json:"action"` // "create", "update" or "delete"
+	Domain      string `json:"domain"`
+	Type        string `json:"type"`
+	IP          string `json:"ip,omitempty"` // record value, the target for CNAME records, empty on delete
+	TTL         int    `json:"ttl,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// webhookRecord is a record returned by a lookup
+type webhookRecord struct {
+	Domain      string `json:"domain"`
+	Type        string `json:"type"`
+	IP          string `json:"ip"`
+	ID          string `json:"id,omitempty"`
+	Enabled     *bool  `json:"enabled,omitempty"` // true when missing
+	Description string `json:"description,omitempty"`
+}
+
+// NewWebhookProvider creates a new webhook provider for the service at
+// endpoint. A token is sent as bearer token if set, requests carry
+// userAgent and headers.
+func NewWebhookProvider(endpoint, token string, ttl int, timeout time.Duration, tlsConfig *tls.Config, userAgent string, headers map[string]string, logger *zap.Logger, debug bool) (*WebhookProvider, error) {
+	if endpoint == "" {
+		return nil, errors.New("webhook provider requires hostname (the URL of the service)")
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %s: must be an http or https URL", endpoint)
+	}
+
+	// A nil tlsConfig keeps the default verification
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: withHeaders(tr, userAgent, headers),
+	}
+
+	if debug {
+		logger.Debug("webhook provider created",
+			zap.String("url", endpoint),
+			zap.Int("ttl", ttl),
+			zap.Duration("timeout", timeout),
+			zap.Bool("custom_tls", tlsConfig != nil),
+			zap.Int("custom_headers", len(headers)))
+	}
+
+	return &WebhookProvider{
+		url:    endpoint,
+		token:  token,
+		ttl:    ttl,
+		client: client,
+		logger: logger,
+		debug:  debug,
+	}, nil
+}
+
+func (p *WebhookProvider) CreateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("creating webhook record",
+			zap.String("domain", domain),
+			zap.String("record_type", recordType),
+			zap.String("value", value))
+	}
+
+	return p.change(ctx, webhookRequest{
+		Action:      "create",
+		Domain:      domain,
+		Type:        recordType,
+		IP:          value,
+		TTL:         p.ttl,
+		Description: recordDescription(ctx, managedDescription),
+	})
+}
+
+func (p *WebhookProvider) UpdateRecord(ctx context.Context, domain, recordType, value string) error {
+	if p.debug {
+		p.logger.Debug("updating webhook record", zap.String("domain", domain), zap.String("record_type", recordType), zap.String("value", value))
+	}
+
+	return p.change(ctx, webhookRequest{
+		Action:      "update",
+		Domain:      domain,
+		Type:        recordType,
+		IP:          value,
+		TTL:         p.ttl,
+		Description: recordDescription(ctx, managedDescription),
+	})
+}
+
+func (p *WebhookProvider) DeleteRecord(ctx context.Context, domain, recordType string) error {
+	if p.debug {
+		p.logger.Debug("deleting webhook record", zap.String("domain", domain), zap.String("record_type", recordType))
+	}
+
+	return p.change(ctx, webhookRequest{
+		Action: "delete",
+		Domain: domain,
+		Type:   recordType,
+	})
+}
+
+func (p *WebhookProvider) FindRecord(ctx context.Context, domain string) ([]*DNSRecord, error) {
+	if p.debug {
+		p.logger.Debug("searching webhook records", zap.String("domain", domain))
+	}
+
+	rows, err := p.lookup(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, row := range rows {
+		// Services may answer with more than the requested name
+		if row.Domain != "" && !strings.EqualFold(strings.TrimSuffix(row.Domain, "."), domain) {
+			continue
+		}
+		if row.Type == "" {
+			row.Type = RecordTypeForIP(row.IP)
+		}
+		records = append(records, &DNSRecord{
+			Domain:      domain,
+			Value:       row.IP,
+			RecordType:  row.Type,
+			UUID:        row.ID,
+			Enabled:     row.Enabled == nil || *row.Enabled,
+			Description: row.Description,
+		})
+	}
+
+	if p.debug {
+		p.logger.Debug("found webhook records", zap.String("domain", domain), zap.Int("count", len(records)))
+	}
+	return records, nil
+}
+
+func (p *WebhookProvider) Validate(ctx context.Context) error {
+	if p.debug {
+		p.logger.Debug("validating webhook connectivity", zap.String("url", p.url))
+	}
+
+	// Looking up a reserved name must succeed, even without records
+	_, err := p.lookup(ctx, "caddy-local-dns.invalid")
+	return err
+}
+
+// change POSTs req and reports the ID of the written record, if returned
+func (p *WebhookProvider) change(ctx context.Context, req webhookRequest) error {
+	resp, err := p.apiCall(ctx, "POST", p.url, req)
+	if err != nil {
+		if errors.Is(err, errWebhookNotImplemented) {
+			return ErrUnsupportedRecordType{RecordType: req.Type, Backend: "the webhook service"}
+		}
+		return err
+	}
+
+	var res struct {
+		ID string `json:"id"`
+	}
+	if req.Action != "delete" && json.Unmarshal(resp, &res) == nil && res.ID != "" {
+		setRecordID(ctx, res.ID)
+	}
+	return nil
+}
+
+// lookup returns the records the service reports for domain
+func (p *WebhookProvider) lookup(ctx context.Context, domain string) ([]webhookRecord, error) {
+	lookupURL, err := url.Parse(p.url)
+	if err != nil {
+		return nil, err
+	}
+	query := lookupURL.Query()
+	query.Set("domain", domain)
+	lookupURL.RawQuery = query.Encode()
+
+	resp, err := p.apiCall(ctx, "GET", lookupURL.String(), nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(resp)) == 0 {
+		return nil, nil
+	}
+	var rows []webhookRecord
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, fmt.Errorf("unexpected lookup response, want a JSON array of records: %w", err)
+	}
+	return rows, nil
+}
+
+// errWebhookNotImplemented is returned by apiCall for 501 responses
+var errWebhookNotImplemented = errors.New("not implemented by the webhook service")
+
+// apiCall sends a request to the service and returns the response body
+func (p *WebhookProvider) apiCall(ctx context.Context, method, apiURL string, payload any) ([]byte, error) {
+	if p.debug {
+		p.logger.Debug("making API call",
+			zap.String("method", method),
+			zap.String("url", apiURL),
+			zap.Any("payload", payload))
+	}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if p.debug {
+			p.logger.Debug("API call failed", zap.Error(err))
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.debug {
+		p.logger.Debug("API call response",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(out)))
+	}
+
+	if resp.StatusCode == http.StatusNotImplemented {
+		return nil, fmt.Errorf("%w: %s", errWebhookNotImplemented, string(out))
+	}
+	if resp.StatusCode >= 400 {
+		return nil, statusError(resp.StatusCode, out)
+	}
+	return out, nil
+}
+
+// Interface compliance
+var _ DNSService = (*WebhookProvider)(nil)
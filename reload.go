@@ -0,0 +1,98 @@
+package local_dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/mietzen/caddy-local-dns/provider"
+	"go.uber.org/zap"
+)
+
+// runningApp is the started app. A config reload provisions the new app
+// while the old one still runs, so the clients of unchanged providers and
+// the managed records are taken over from it.
+var (
+	runningApp   *App
+	runningAppMu sync.Mutex
+)
+
+// providerKey identifies the settings a client was created with, after
+// placeholders like {env.OPNSENSE_SECRET} are expanded
+func (a *App) providerKey(config *ProviderConfig) string {
+	data, _ := json.Marshal(config)
+	return fmt.Sprintf("%t %s", a.DebugProviders, data)
+}
+
+// reusableClient returns the client the running app created for the
+// provider name if its settings are unchanged
+func reusableClient(name, key string) (provider.DNSService, bool) {
+	runningAppMu.Lock()
+	defer runningAppMu.Unlock()
+
+	if runningApp == nil || runningApp.providerKeys[name] != key {
+		return nil, false
+	}
+	client, exists := runningApp.rawClients[name]
+	return client, exists
+}
+
+// takeOverRecords copies the managed records of previous that a doesn't
+// track yet, so they are still tracked after a reload. The previous app
+// neither deletes them with cleanup_on_stop nor writes the state file
+// anymore.
+func (a *App) takeOverRecords(previous *App) {
+	if previous == nil {
+		return
+	}
+
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	count := 0
+	for key, record := range previous.managed {
+		// Records of removed providers can't be managed anymore
+		if _, exists := a.clients[key.Provider]; !exists {
+			continue
+		}
+		if _, exists := a.managed[key]; exists {
+			continue
+		}
+		copied := *record
+		a.managed[key] = &copied
+		count++
+	}
+
+	if count > 0 {
+		a.logger.Info("took over managed records of the previous config", zap.Int("count", count))
+	}
+}
+
+// currentApp returns the running app, nil if there is none
+func currentApp() *App {
+	runningAppMu.Lock()
+	defer runningAppMu.Unlock()
+	return runningApp
+}
+
+// markRunning makes a the running app
+func (a *App) markRunning() {
+	runningAppMu.Lock()
+	defer runningAppMu.Unlock()
+	runningApp = a
+}
+
+// markStopped clears the running app if it is a. Otherwise a reload
+// replaced a, and the app that runs instead is returned.
+func (a *App) markStopped() *App {
+	runningAppMu.Lock()
+	defer runningAppMu.Unlock()
+
+	if runningApp == a {
+		runningApp = nil
+		return nil
+	}
+	return runningApp
+}
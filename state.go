@@ -0,0 +1,102 @@
+package local_dns
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// loadState restores the managed records from state_file. A missing or
+// corrupt file is logged and ignored, tracking starts fresh then.
+func (a *App) loadState() {
+	if a.StateFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(a.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		a.logger.Warn("failed to read state file, starting fresh", zap.String("path", a.StateFile), zap.Error(err))
+		return
+	}
+
+	var records []ManagedRecordInfo
+	if err := json.Unmarshal(data, &records); err != nil {
+		a.logger.Warn("corrupt state file, starting fresh", zap.String("path", a.StateFile), zap.Error(err))
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, record := range records {
+		// Records of removed providers can't be managed anymore
+		if _, exists := a.clients[record.Provider]; !exists {
+			continue
+		}
+		key := managedKey{Provider: record.Provider, Domain: record.Domain, RecordType: record.RecordType}
+		// Records taken over on reload are more recent
+		if _, exists := a.managed[key]; exists {
+			continue
+		}
+		// State files of older versions lack the request time, start counting now
+		if record.LastSeen.IsZero() {
+			record.LastSeen = time.Now()
+		}
+		a.managed[key] = &managedRecord{Value: record.Value, ID: record.ID, LastSync: record.LastSync, LastSeen: record.LastSeen}
+	}
+
+	a.logger.Info("restored managed records", zap.String("path", a.StateFile), zap.Int("count", len(a.managed)))
+}
+
+// saveState writes the managed records to state_file. The file is replaced
+// atomically, so a crash never leaves a partial state behind.
+func (a *App) saveState() {
+	if a.StateFile == "" {
+		return
+	}
+	// After a reload the new app owns the file, the old one is stopping
+	if current := currentApp(); current != nil && current != a {
+		return
+	}
+
+	// Snapshot while holding stateMu, so writes can't overtake each other
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	if err := writeState(a.StateFile, a.ManagedRecords()); err != nil {
+		a.logger.Error("failed to write state file", zap.String("path", a.StateFile), zap.Error(err))
+	}
+}
+
+func writeState(path string, records []ManagedRecordInfo) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".local-dns-state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}